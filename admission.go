@@ -0,0 +1,23 @@
+package tlru
+
+// recordAccess notes a request for key in the admission sketch, if any.
+func (l *Cache[K, V]) recordAccess(key K) {
+	if l.admission != nil {
+		l.admission.Add(l.admissionHash(key))
+	}
+}
+
+// admit decides whether a new entry for key may be stored. Without an
+// admission policy, or when there is room, every entry is admitted.
+// Otherwise, key must be estimated to be more popular than the entry it
+// would evict.
+func (l *Cache[K, V]) admit(key K) bool {
+	if l.admission == nil || !l.overLimit(1) {
+		return true
+	}
+	victim, ok := l.victim()
+	if !ok {
+		return true
+	}
+	return l.admission.Estimate(l.admissionHash(key)) > l.admission.Estimate(l.admissionHash(victim))
+}
@@ -0,0 +1,71 @@
+package tlru
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmission(t *testing.T) {
+	t.Run("RejectsColdKeys", func(t *testing.T) {
+		c := New(ConstantCost[int], 2, WithAdmission[string, int](StringHasher(), 2))
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Hour)
+		for i := 0; i < 5; i++ {
+			c.Get("a")
+			c.Get("b")
+		}
+		for i := 0; i < 10; i++ {
+			c.Set("cold"+strconv.Itoa(i), i, time.Hour)
+		}
+		require.ElementsMatch(t, []string{"a", "b"}, c.Keys())
+		require.EqualValues(t, 10, c.Stats().Rejections)
+
+		// Replacing an existing key is always allowed.
+		c.Set("a", 3, time.Hour)
+		v, _, ok := c.Get("a")
+		require.True(t, ok)
+		require.Equal(t, 3, v)
+	})
+
+	t.Run("ConditionalSet", func(t *testing.T) {
+		c := New(ConstantCost[int], 2, WithAdmission[string, int](StringHasher(), 2))
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Hour)
+		for i := 0; i < 5; i++ {
+			c.Get("a")
+			c.Get("b")
+		}
+
+		// A rejected key is reported as not stored.
+		require.False(t, c.SetIfAbsent("cold", 3, time.Hour))
+		_, set := c.SetNX("cold", 3, time.Hour)
+		require.False(t, set)
+		_, loaded, stored := c.GetOrSet("cold", 3, time.Hour)
+		require.False(t, loaded)
+		require.False(t, stored)
+		require.False(t, c.Contains("cold"))
+	})
+
+	t.Run("Zipf", func(t *testing.T) {
+		hitRatio := func(opts ...Option[int, int]) float64 {
+			c := New(ConstantCost[int], 100, opts...)
+			r := rand.New(rand.NewSource(1))
+			zipf := rand.NewZipf(r, 1.1, 1, 10000)
+			for i := 0; i < 100000; i++ {
+				k := int(zipf.Uint64())
+				if _, _, ok := c.Get(k); !ok {
+					c.Set(k, k, time.Hour)
+				}
+			}
+			return c.Stats().HitRatio()
+		}
+		plain := hitRatio()
+		admitted := hitRatio(WithAdmission[int, int](IntegerHasher[int], 100))
+		t.Logf("hit ratio: plain %.3f, admission %.3f", plain, admitted)
+		require.Greater(t, admitted, plain)
+	})
+}
@@ -0,0 +1,15 @@
+package tlru
+
+import "time"
+
+// Clock tells the current time. It must be safe for concurrent use.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is a Clock backed by time.Now.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
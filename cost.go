@@ -0,0 +1,91 @@
+package tlru
+
+import "reflect"
+
+// StringCost is a Coster that returns the length of a string in bytes.
+func StringCost(v string) int {
+	return len(v)
+}
+
+// BytesCost is a Coster that returns the length of a byte slice.
+func BytesCost(v []byte) int {
+	return len(v)
+}
+
+// ApproxSizeCost is a Coster that estimates the memory footprint of v in
+// bytes by walking it with reflection, following pointers and interfaces
+// and counting the contents of strings, slices and maps.
+//
+// The estimate ignores allocator and map bucket overhead, and counts
+// strings shared between values once per reference. Memory reached through
+// channels and functions is not counted. Walking large values is slow and
+// allocates, so prefer a purpose-built Coster on hot paths.
+func ApproxSizeCost[T any](v T) int {
+	rv := reflect.ValueOf(&v).Elem()
+	return int(rv.Type().Size()) + referencedSize(rv, make(map[uintptr]struct{}))
+}
+
+// referencedSize returns the size of the memory v refers to, excluding v
+// itself. seen holds the addresses already counted, which also guards
+// against cycles.
+func referencedSize(v reflect.Value, seen map[uintptr]struct{}) int {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || visited(v.Pointer(), seen) {
+			return 0
+		}
+		elem := v.Elem()
+		return int(elem.Type().Size()) + referencedSize(elem, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int(elem.Type().Size()) + referencedSize(elem, seen)
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice:
+		if v.IsNil() || visited(v.Pointer(), seen) {
+			return 0
+		}
+		n := v.Cap() * int(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += referencedSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Array:
+		var n int
+		for i := 0; i < v.Len(); i++ {
+			n += referencedSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Struct:
+		var n int
+		for i := 0; i < v.NumField(); i++ {
+			n += referencedSize(v.Field(i), seen)
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() || visited(v.Pointer(), seen) {
+			return 0
+		}
+		entry := int(v.Type().Key().Size() + v.Type().Elem().Size())
+		var n int
+		iter := v.MapRange()
+		for iter.Next() {
+			n += entry + referencedSize(iter.Key(), seen) + referencedSize(iter.Value(), seen)
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// visited reports whether p was already counted, marking it if not.
+func visited(p uintptr, seen map[uintptr]struct{}) bool {
+	if _, ok := seen[p]; ok {
+		return true
+	}
+	seen[p] = struct{}{}
+	return false
+}
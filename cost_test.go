@@ -0,0 +1,47 @@
+package tlru
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringCost(t *testing.T) {
+	require.Equal(t, 5, StringCost("hello"))
+	require.Equal(t, 3, BytesCost([]byte("abc")))
+
+	c := New[string](StringCost, 10)
+	c.Set("a", "hello", 0)
+	require.Equal(t, 5, c.Cost())
+}
+
+func TestApproxSizeCost(t *testing.T) {
+	// Headers vary by architecture.
+	var (
+		ptr   = int(unsafe.Sizeof(uintptr(0)))
+		str   = int(unsafe.Sizeof(""))
+		slice = int(unsafe.Sizeof([]int64(nil)))
+	)
+
+	require.Equal(t, 8, ApproxSizeCost(int64(1)))
+	// Header plus contents.
+	require.Equal(t, str+5, ApproxSizeCost("hello"))
+	require.Equal(t, slice+4*8, ApproxSizeCost(make([]int64, 2, 4)))
+
+	type node struct {
+		Name string
+		Next *node
+	}
+	a := &node{Name: "a"}
+	b := &node{Name: "bb", Next: a}
+	// A cycle is only counted once.
+	a.Next = b
+	require.Equal(t, ptr+2*int(unsafe.Sizeof(node{}))+1+2, ApproxSizeCost(a))
+
+	m := map[string]int64{"ab": 1}
+	require.Equal(t, ptr+str+8+2, ApproxSizeCost(m))
+
+	var iface any = int64(1)
+	require.Equal(t, int(unsafe.Sizeof(iface))+8, ApproxSizeCost(iface))
+}
@@ -0,0 +1,79 @@
+package tlru
+
+// EvictReason describes why an entry left the cache.
+type EvictReason int
+
+const (
+	// ReasonExpired means the entry's deadline passed.
+	ReasonExpired EvictReason = iota
+	// ReasonCostOverage means the entry was the least-recently-used entry
+	// while the cache exceeded its cost limit.
+	ReasonCostOverage
+	// ReasonReplaced means the entry was overwritten by a call to Set.
+	ReasonReplaced
+	// ReasonManual means the entry was removed by Delete or Clear.
+	ReasonManual
+	// ReasonPopped means the entry was handed to the caller of Pop, who
+	// now owns it. Callbacks should not release its resources.
+	ReasonPopped
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonCostOverage:
+		return "cost_overage"
+	case ReasonReplaced:
+		return "replaced"
+	case ReasonManual:
+		return "manual"
+	case ReasonPopped:
+		return "popped"
+	default:
+		return "unknown"
+	}
+}
+
+// EvictEvent describes an entry that left the cache, as delivered by
+// Events.
+type EvictEvent[K comparable, V any] struct {
+	Key    K
+	Value  V
+	Reason EvictReason
+}
+
+// eventBuffer is the capacity of the channel returned by Events.
+const eventBuffer = 1024
+
+// Events returns a channel that receives an event whenever an entry leaves
+// the cache, created on first call. Unlike WithOnEvict, events are handled
+// outside the cache's critical section, so the consumer may call methods
+// on the cache.
+//
+// The channel buffers up to 1024 events. Events are dropped while the
+// buffer is full, so a slow consumer misses some rather than stall the
+// cache. The channel is never closed.
+func (l *Cache[K, V]) Events() <-chan EvictEvent[K, V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.events == nil {
+		l.events = make(chan EvictEvent[K, V], eventBuffer)
+	}
+	return l.events
+}
+
+// notifyEvict reports an entry leaving the cache to the OnEvict callback
+// and the Events channel.
+func (l *Cache[K, V]) notifyEvict(key K, v V, reason EvictReason) {
+	if l.onEvict != nil {
+		l.onEvict(key, v, reason)
+	}
+	if l.events != nil {
+		select {
+		case l.events <- EvictEvent[K, V]{Key: key, Value: v, Reason: reason}:
+		default:
+		}
+	}
+}
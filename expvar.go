@@ -0,0 +1,51 @@
+package tlru
+
+import "expvar"
+
+// expvarStats is the JSON representation published by PublishExpvar.
+type expvarStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Computed      uint64 `json:"computed"`
+	Insertions    uint64 `json:"insertions"`
+	Rejections    uint64 `json:"rejections"`
+	Expirations   uint64 `json:"expirations"`
+	CostEvictions uint64 `json:"cost_evictions"`
+	Evictions     uint64 `json:"evictions"`
+	OverLimit     uint64 `json:"over_limit"`
+	Cost          int    `json:"cost"`
+	Len           int    `json:"len"`
+}
+
+// PublishExpvar publishes the cache's stats, cost and length under name
+// with the expvar package, making them available at /debug/vars. Reading
+// the variable does not evict anything, so scrapes never trigger eviction
+// callbacks.
+// Like expvar.Publish, it panics if name is already in use, so call it
+// once per cache.
+func (l *Cache[K, V]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		s := l.Stats()
+		return expvarStats{
+			Hits:          s.Hits,
+			Misses:        s.Misses,
+			Computed:      s.Computed,
+			Insertions:    s.Insertions,
+			Rejections:    s.Rejections,
+			Expirations:   s.Expirations,
+			CostEvictions: s.CostEvictions,
+			Evictions:     s.Expirations + s.CostEvictions,
+			OverLimit:     s.OverLimit,
+			Cost:          l.Cost(),
+			Len:           l.expvarLen(),
+		}
+	}))
+}
+
+// expvarLen counts the live entries under the read lock.
+func (l *Cache[K, V]) expvarLen() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.liveLen()
+}
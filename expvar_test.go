@@ -0,0 +1,55 @@
+package tlru
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// expvarSeq makes published names unique across repeated test runs, since
+// expvar names can't be unpublished.
+var expvarSeq atomic.Uint64
+
+func expvarName(t *testing.T) string {
+	return t.Name() + "_" + strconv.FormatUint(expvarSeq.Add(1), 10)
+}
+
+func TestPublishExpvar(t *testing.T) {
+	clock := newFakeClock()
+	var evictions int
+	c := New(ConstantCost[int], 2,
+		WithClock[string, int](clock),
+		WithOnEvict(func(string, int, EvictReason) {
+			evictions++
+		}),
+	)
+	name := expvarName(t)
+	c.PublishExpvar(name)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Set("c", 3, time.Hour)
+	c.Get("b")
+	c.Get("c")
+	c.Get("z")
+	require.Equal(t, 1, evictions)
+
+	// "b" expires, but reading the variable doesn't evict it.
+	clock.Advance(time.Minute)
+	var got map[string]int
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get(name).String()), &got))
+	require.Equal(t, 2, got["hits"])
+	require.Equal(t, 1, got["misses"])
+	require.Equal(t, 1, got["evictions"])
+	require.Equal(t, 2, got["cost"])
+	require.Equal(t, 1, got["len"])
+	require.Equal(t, 1, evictions)
+
+	require.Panics(t, func() {
+		c.PublishExpvar(name)
+	})
+}
@@ -0,0 +1,3 @@
+// Package cmsketch implements a count-min sketch of small, periodically
+// halved counters, as used by the TinyLFU admission policy.
+package cmsketch
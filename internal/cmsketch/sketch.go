@@ -0,0 +1,92 @@
+package cmsketch
+
+const depth = 4
+
+// maxCount is the value at which counters saturate.
+const maxCount = 15
+
+// seeds decorrelate the rows of the sketch.
+var seeds = [depth]uint64{
+	0xc3a5c85c97cb3127,
+	0xb492b66fbe98f273,
+	0x9ae16a3b2f90404f,
+	0xcbf29ce484222325,
+}
+
+// Sketch estimates how often hashes were added. Estimates may overcount
+// but never undercount, except that all counts are halved periodically so
+// that the sketch favors recent activity.
+type Sketch struct {
+	rows [depth][]uint8
+	mask uint64
+	// additions counts Adds since the last halving.
+	additions int
+	// resetAt is the number of additions that triggers a halving.
+	resetAt int
+}
+
+// New returns a sketch sized for roughly n distinct hot items.
+func New(n int) *Sketch {
+	width := 16
+	for width < n {
+		width *= 2
+	}
+	s := &Sketch{
+		mask:    uint64(width - 1),
+		resetAt: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *Sketch) index(h uint64, row int) uint64 {
+	h ^= seeds[row]
+	h *= 0x9e3779b97f4a7c15
+	h ^= h >> 32
+	return h & s.mask
+}
+
+// Add records an occurrence of h.
+func (s *Sketch) Add(h uint64) {
+	for i := range s.rows {
+		c := &s.rows[i][s.index(h, i)]
+		if *c < maxCount {
+			*c++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.halve()
+	}
+}
+
+// Estimate returns the approximate number of occurrences of h.
+func (s *Sketch) Estimate(h uint64) int {
+	least := maxCount
+	for i := range s.rows {
+		if c := int(s.rows[i][s.index(h, i)]); c < least {
+			least = c
+		}
+	}
+	return least
+}
+
+func (s *Sketch) halve() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] /= 2
+		}
+	}
+	s.additions /= 2
+}
+
+// Clone returns an independent copy of the sketch.
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	for i := range c.rows {
+		c.rows[i] = append([]uint8(nil), s.rows[i]...)
+	}
+	return &c
+}
@@ -0,0 +1,59 @@
+package cmsketch
+
+import "testing"
+
+func TestSketch(t *testing.T) {
+	s := New(100)
+	for i := 0; i < 5; i++ {
+		s.Add(1)
+	}
+	s.Add(2)
+	if got := s.Estimate(1); got != 5 {
+		t.Fatalf("estimate of 1 is %v", got)
+	}
+	if got := s.Estimate(2); got != 1 {
+		t.Fatalf("estimate of 2 is %v", got)
+	}
+	if got := s.Estimate(3); got != 0 {
+		t.Fatalf("estimate of 3 is %v", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		s.Add(1)
+	}
+	if got := s.Estimate(1); got > maxCount {
+		t.Fatalf("estimate of 1 is %v", got)
+	}
+}
+
+func TestSketch_Halve(t *testing.T) {
+	s := New(16)
+	for i := 0; i < 8; i++ {
+		s.Add(1)
+	}
+	s.halve()
+	if got := s.Estimate(1); got != 4 {
+		t.Fatalf("estimate of 1 is %v after halving", got)
+	}
+
+	// Halving happens on its own once enough items are added.
+	for i := 0; i < s.resetAt; i++ {
+		s.Add(uint64(i))
+	}
+	if s.additions >= s.resetAt {
+		t.Fatalf("sketch was not halved")
+	}
+}
+
+func TestSketch_Clone(t *testing.T) {
+	s := New(16)
+	s.Add(1)
+	c := s.Clone()
+	c.Add(1)
+	if got := s.Estimate(1); got != 1 {
+		t.Fatalf("original estimate of 1 is %v", got)
+	}
+	if got := c.Estimate(1); got != 2 {
+		t.Fatalf("clone estimate of 1 is %v", got)
+	}
+}
@@ -6,6 +6,16 @@ type Node[T any] struct {
 	prev *Node[T]
 }
 
+// Next returns the node following n, towards the head of the list.
+func (n *Node[T]) Next() *Node[T] {
+	return n.next
+}
+
+// Prev returns the node preceding n, towards the tail of the list.
+func (n *Node[T]) Prev() *Node[T] {
+	return n.prev
+}
+
 type List[T any] struct {
 	data T
 	head *Node[T]
@@ -43,3 +43,26 @@ func TestList(t *testing.T) {
 		t.Fatalf("unexpected data %v", n.Data)
 	}
 }
+
+func TestNode_NextPrev(t *testing.T) {
+	l := &List[int]{}
+	l.Append(1)
+	l.Append(2)
+	l.Append(3)
+
+	var forward []int
+	for n := l.Tail(); n != nil; n = n.Next() {
+		forward = append(forward, n.Data)
+	}
+	if !reflect.DeepEqual(forward, []int{1, 2, 3}) {
+		t.Fatalf("unexpected forward order %v", forward)
+	}
+
+	var backward []int
+	for n := l.Head(); n != nil; n = n.Prev() {
+		backward = append(backward, n.Data)
+	}
+	if !reflect.DeepEqual(backward, []int{3, 2, 1}) {
+		t.Fatalf("unexpected backward order %v", backward)
+	}
+}
@@ -0,0 +1,4 @@
+// Package minheap implements a binary min-heap whose items remember their
+// position, so that arbitrary items can be removed or re-prioritized in
+// logarithmic time.
+package minheap
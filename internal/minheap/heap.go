@@ -0,0 +1,214 @@
+package minheap
+
+// Item is an element of a Heap.
+type Item[T any] struct {
+	Value T
+	// index is the position of the item in the heap, or -1 once removed.
+	index int
+}
+
+// Heap is a binary min-heap ordered by a user-provided less function.
+type Heap[T any] struct {
+	less  func(a, b T) bool
+	items []*Item[T]
+}
+
+// New returns an empty heap ordered by less.
+func New[T any](less func(a, b T) bool) *Heap[T] {
+	return &Heap[T]{less: less}
+}
+
+// Len returns the number of items in the heap.
+func (h *Heap[T]) Len() int {
+	return len(h.items)
+}
+
+// Push adds v to the heap, returning its item.
+func (h *Heap[T]) Push(v T) *Item[T] {
+	it := &Item[T]{Value: v, index: len(h.items)}
+	h.items = append(h.items, it)
+	h.up(it.index)
+	return it
+}
+
+// Min returns the least item without removing it.
+func (h *Heap[T]) Min() (*Item[T], bool) {
+	if len(h.items) == 0 {
+		return nil, false
+	}
+	return h.items[0], true
+}
+
+// Remove removes it from the heap. It returns false if it is not in the
+// heap.
+func (h *Heap[T]) Remove(it *Item[T]) bool {
+	if !h.contains(it) {
+		return false
+	}
+	i := it.index
+	last := len(h.items) - 1
+	if i != last {
+		h.swap(i, last)
+	}
+	h.items[last] = nil
+	h.items = h.items[:last]
+	if i != last {
+		h.fix(i)
+	}
+	it.index = -1
+	return true
+}
+
+// RemoveMany removes its from the heap, returning the number of items
+// removed. It rebuilds the heap in O(n), which makes it cheaper than
+// calling Remove for each item when removing a large fraction of the heap.
+func (h *Heap[T]) RemoveMany(its []*Item[T]) int {
+	var removed int
+	for _, it := range its {
+		if h.contains(it) {
+			h.items[it.index] = nil
+			it.index = -1
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0
+	}
+
+	kept := h.items[:0]
+	for _, it := range h.items {
+		if it != nil {
+			it.index = len(kept)
+			kept = append(kept, it)
+		}
+	}
+	for i := len(kept); i < len(h.items); i++ {
+		h.items[i] = nil
+	}
+	h.items = kept
+	for i := len(h.items)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+	return removed
+}
+
+// Fix restores the heap ordering after it.Value has changed. It returns
+// false if it is not in the heap.
+func (h *Heap[T]) Fix(it *Item[T]) bool {
+	if !h.contains(it) {
+		return false
+	}
+	h.fix(it.index)
+	return true
+}
+
+// Clear removes all items from the heap.
+func (h *Heap[T]) Clear() {
+	for i, it := range h.items {
+		it.index = -1
+		h.items[i] = nil
+	}
+	h.items = h.items[:0]
+}
+
+// Walk calls fn for items in the heap, visiting every item before its
+// descendants. If fn returns false, the item's descendants are skipped, so
+// walking the items less than some bound only touches those items and
+// their immediate children. The heap must not be modified during Walk.
+func (h *Heap[T]) Walk(fn func(it *Item[T]) bool) {
+	if len(h.items) == 0 {
+		return
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !fn(h.items[i]) {
+			continue
+		}
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(h.items) {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+// Ascend calls fn for items in ascending order until fn returns false.
+// Items are visited lazily, so stopping early after k items costs
+// O(k log k). The heap must not be modified during Ascend.
+func (h *Heap[T]) Ascend(fn func(it *Item[T]) bool) {
+	if len(h.items) == 0 {
+		return
+	}
+	// frontier holds the indices of the least unvisited items.
+	frontier := New(func(a, b int) bool {
+		return h.less(h.items[a].Value, h.items[b].Value)
+	})
+	frontier.Push(0)
+	for {
+		next, ok := frontier.Min()
+		if !ok {
+			return
+		}
+		frontier.Remove(next)
+		i := next.Value
+		if !fn(h.items[i]) {
+			return
+		}
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(h.items) {
+				frontier.Push(child)
+			}
+		}
+	}
+}
+
+func (h *Heap[T]) contains(it *Item[T]) bool {
+	return it != nil && it.index >= 0 && it.index < len(h.items) && h.items[it.index] == it
+}
+
+func (h *Heap[T]) fix(i int) {
+	if !h.down(i) {
+		h.up(i)
+	}
+}
+
+func (h *Heap[T]) swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *Heap[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(h.items[i].Value, h.items[parent].Value) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+// down sifts the item at i towards the leaves, reporting whether it moved.
+func (h *Heap[T]) down(i int) bool {
+	start := i
+	n := len(h.items)
+	for {
+		left := 2*i + 1
+		if left >= n {
+			break
+		}
+		least := left
+		if right := left + 1; right < n && h.less(h.items[right].Value, h.items[left].Value) {
+			least = right
+		}
+		if !h.less(h.items[least].Value, h.items[i].Value) {
+			break
+		}
+		h.swap(i, least)
+		i = least
+	}
+	return i > start
+}
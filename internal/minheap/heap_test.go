@@ -0,0 +1,177 @@
+package minheap
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func intLess(a, b int) bool {
+	return a < b
+}
+
+func drain(h *Heap[int]) []int {
+	var vs []int
+	for {
+		it, ok := h.Min()
+		if !ok {
+			return vs
+		}
+		vs = append(vs, it.Value)
+		h.Remove(it)
+	}
+}
+
+func TestHeap(t *testing.T) {
+	h := New(intLess)
+	r := rand.New(rand.NewSource(1))
+	var want []int
+	for i := 0; i < 100; i++ {
+		v := r.Intn(50)
+		want = append(want, v)
+		h.Push(v)
+	}
+	sort.Ints(want)
+
+	got := drain(h)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected order %v", got)
+		}
+	}
+}
+
+func TestHeap_RemoveFix(t *testing.T) {
+	h := New(intLess)
+	items := make([]*Item[int], 10)
+	for i := range items {
+		items[i] = h.Push(i)
+	}
+
+	if !h.Remove(items[5]) {
+		t.Fatalf("remove failed")
+	}
+	if h.Remove(items[5]) {
+		t.Fatalf("removed twice")
+	}
+	if h.Fix(items[5]) {
+		t.Fatalf("fixed removed item")
+	}
+
+	items[0].Value = 100
+	h.Fix(items[0])
+	items[9].Value = -1
+	h.Fix(items[9])
+
+	got := drain(h)
+	want := []int{-1, 1, 2, 3, 4, 6, 7, 8, 100}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected contents %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected contents %v", got)
+		}
+	}
+}
+
+func TestHeap_Clear(t *testing.T) {
+	h := New(intLess)
+	it := h.Push(1)
+	h.Push(2)
+	h.Clear()
+	if h.Len() != 0 {
+		t.Fatalf("len is %v", h.Len())
+	}
+	if h.Remove(it) {
+		t.Fatalf("removed cleared item")
+	}
+}
+
+func TestHeap_Walk(t *testing.T) {
+	h := New(intLess)
+	r := rand.New(rand.NewSource(1))
+	var want int
+	for i := 0; i < 100; i++ {
+		v := r.Intn(100)
+		if v < 20 {
+			want++
+		}
+		h.Push(v)
+	}
+
+	var got, visited int
+	h.Walk(func(it *Item[int]) bool {
+		visited++
+		if it.Value >= 20 {
+			return false
+		}
+		got++
+		return true
+	})
+	if got != want {
+		t.Fatalf("walked %v items below bound, want %v", got, want)
+	}
+	if visited > 2*want+1 {
+		t.Fatalf("visited %v items, want at most %v", visited, 2*want+1)
+	}
+}
+
+func TestHeap_Ascend(t *testing.T) {
+	h := New(intLess)
+	r := rand.New(rand.NewSource(1))
+	var want []int
+	for i := 0; i < 100; i++ {
+		v := r.Intn(50)
+		want = append(want, v)
+		h.Push(v)
+	}
+	sort.Ints(want)
+
+	var got []int
+	h.Ascend(func(it *Item[int]) bool {
+		got = append(got, it.Value)
+		return len(got) < 10
+	})
+	if len(got) != 10 {
+		t.Fatalf("ascend did not stop early: %v", got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected order %v", got)
+		}
+	}
+	// Ascend leaves the heap intact.
+	if h.Len() != 100 {
+		t.Fatalf("heap has %v items", h.Len())
+	}
+}
+
+func TestHeap_RemoveMany(t *testing.T) {
+	h := New(intLess)
+	items := make([]*Item[int], 100)
+	for i := range items {
+		items[i] = h.Push(99 - i)
+	}
+
+	var remove []*Item[int]
+	for i := 0; i < len(items); i += 2 {
+		remove = append(remove, items[i])
+	}
+	// Duplicates and already removed items are ignored.
+	remove = append(remove, items[0])
+	h.Remove(items[2])
+	if n := h.RemoveMany(remove); n != 49 {
+		t.Fatalf("removed %v items", n)
+	}
+
+	got := drain(h)
+	if len(got) != 50 {
+		t.Fatalf("unexpected contents %v", got)
+	}
+	for i, v := range got {
+		if v != 2*i {
+			t.Fatalf("unexpected order %v", got)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package singleflight provides duplicate call suppression, in the spirit of
+// golang.org/x/sync/singleflight, without the extra dependency.
+package singleflight
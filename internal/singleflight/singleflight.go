@@ -0,0 +1,108 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPanicked is returned to callers that were waiting on a call whose
+// function panicked.
+var ErrPanicked = errors.New("singleflight: function panicked")
+
+type call[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// Result holds the results of Do, for use with DoChan.
+type Result[V any] struct {
+	Val V
+	Err error
+	// Shared is true if the results came from another caller's execution.
+	Shared bool
+}
+
+// Group deduplicates concurrent calls by key. The zero value is ready to use.
+type Group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+// Do executes fn, making sure only one execution is in-flight for a given
+// key at a time. Duplicate callers wait for the original to complete and
+// receive the same results. shared is true for callers that did not
+// execute fn themselves.
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	c, leader := g.join(key)
+	if !leader {
+		<-c.done
+		return c.val, c.err, true
+	}
+	g.run(key, c, fn)
+	return c.val, c.err, false
+}
+
+// DoChan is like Do but returns a channel that receives the results once
+// they are ready. The channel is buffered, so abandoning it does not leak
+// the execution.
+func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
+	ch := make(chan Result[V], 1)
+	c, leader := g.join(key)
+	if !leader {
+		go func() {
+			<-c.done
+			ch <- Result[V]{Val: c.val, Err: c.err, Shared: true}
+		}()
+		return ch
+	}
+	go func() {
+		g.run(key, c, fn)
+		ch <- Result[V]{Val: c.val, Err: c.err}
+	}()
+	return ch
+}
+
+// Go starts fn in a new goroutine unless a call for key is already in
+// flight. It reports whether fn was started.
+func (g *Group[K, V]) Go(key K, fn func() (V, error)) bool {
+	c, leader := g.join(key)
+	if !leader {
+		return false
+	}
+	go g.run(key, c, fn)
+	return true
+}
+
+// join returns the in-flight call for key, creating it if there is none.
+// leader is true if the caller created the call and must run it.
+func (g *Group[K, V]) join(key K) (c *call[V], leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	if c, ok := g.calls[key]; ok {
+		return c, false
+	}
+	c = &call[V]{done: make(chan struct{})}
+	g.calls[key] = c
+	return c, true
+}
+
+func (g *Group[K, V]) run(key K, c *call[V], fn func() (V, error)) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			c.err = ErrPanicked
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn()
+	normalReturn = true
+}
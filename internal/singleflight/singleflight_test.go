@@ -0,0 +1,117 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGroup_Do(t *testing.T) {
+	var g Group[string, int]
+	v, err, shared := g.Do("a", func() (int, error) {
+		return 1, nil
+	})
+	if v != 1 || err != nil || shared {
+		t.Fatalf("unexpected result %v, %v, %v", v, err, shared)
+	}
+
+	wantErr := errors.New("boom")
+	_, err, _ = g.Do("a", func() (int, error) {
+		return 0, wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestGroup_DoDedupe(t *testing.T) {
+	var (
+		g      Group[string, int]
+		calls  atomic.Int32
+		shares atomic.Int32
+		wg     sync.WaitGroup
+	)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	fn := func() (int, error) {
+		calls.Add(1)
+		close(started)
+		<-release
+		return 42, nil
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Do("a", fn)
+	}()
+	<-started
+
+	const waiters = 10
+	for i := 0; i < waiters; i++ {
+		ch := g.DoChan("a", fn)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := <-ch
+			if res.Val != 42 {
+				t.Errorf("unexpected value %v", res.Val)
+			}
+			if res.Shared {
+				shares.Add(1)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("fn called %v times", calls.Load())
+	}
+	if shares.Load() != waiters {
+		t.Fatalf("%v results shared", shares.Load())
+	}
+}
+
+func TestGroup_DoPanic(t *testing.T) {
+	var g Group[string, int]
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected panic")
+			}
+		}()
+		g.Do("a", func() (int, error) {
+			panic("boom")
+		})
+	}()
+
+	// The key must be usable again.
+	v, err, _ := g.Do("a", func() (int, error) {
+		return 1, nil
+	})
+	if v != 1 || err != nil {
+		t.Fatalf("unexpected result %v, %v", v, err)
+	}
+}
+
+func TestGroup_Go(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	done := make(chan struct{})
+	started := g.Go("a", func() (int, error) {
+		<-release
+		close(done)
+		return 1, nil
+	})
+	if !started {
+		t.Fatalf("first Go did not start")
+	}
+	if g.Go("a", func() (int, error) { return 2, nil }) {
+		t.Fatalf("duplicate Go started")
+	}
+	close(release)
+	<-done
+}
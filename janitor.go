@@ -0,0 +1,43 @@
+package tlru
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StartJanitor starts a goroutine that evicts expired entries every
+// interval, so memory is reclaimed even when the cache is rarely accessed.
+// Calling the returned stop function terminates the goroutine; it is safe
+// to call more than once.
+func (l *Cache[K, V]) StartJanitor(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		l.RunJanitor(ctx, interval)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(cancel)
+		<-exited
+	}
+}
+
+// RunJanitor is like StartJanitor, but runs in the calling goroutine until
+// ctx is done.
+func (l *Cache[K, V]) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			l.evictExpires()
+			l.mu.Unlock()
+		}
+	}
+}
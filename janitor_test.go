@@ -0,0 +1,47 @@
+package tlru
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitor(t *testing.T) {
+	clock := newFakeClock()
+	c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, time.Hour)
+
+	stop := c.StartJanitor(time.Millisecond)
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		return c.Cost() == 1
+	}, time.Second, time.Millisecond)
+	require.EqualValues(t, 1, c.Stats().Expirations)
+
+	stop()
+	// Stopping again is a no-op.
+	stop()
+}
+
+func TestRunJanitor(t *testing.T) {
+	clock := newFakeClock()
+	c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+	c.Set("a", 1, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		c.RunJanitor(ctx, time.Millisecond)
+	}()
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		return c.Cost() == 0
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-exited
+}
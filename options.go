@@ -0,0 +1,182 @@
+package tlru
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ammario/tlru/internal/cmsketch"
+)
+
+// Option configures optional behavior of a Cache. Options are passed to New.
+type Option[K comparable, V any] func(c *Cache[K, V])
+
+// WithRefreshOnGet enables sliding expiration: every successful Get resets
+// the entry's deadline to now plus ttl, so frequently accessed entries
+// never expire.
+func WithRefreshOnGet[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.refreshOnGet = ttl
+	}
+}
+
+// WithDefaultTTL sets the TTL used by SetDefault and by any call passed
+// DefaultTTL.
+func WithDefaultTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.defaultTTL = ttl
+	}
+}
+
+// WithMinTTL raises any positive TTL below ttl to ttl, guarding against
+// misconfigured durations that would make entries vanish instantly. A TTL
+// of zero still expires the entry immediately.
+func WithMinTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.minTTL = ttl
+	}
+}
+
+// WithZeroTTLMeansNoExpiry makes a TTL of zero store entries that never expire
+// instead of expiring them immediately. Such entries leave the cache only
+// through cost eviction or deletion, and report a zero deadline. This
+// applies to loaders such as Do too, which can be told not to cache with
+// NoCache instead.
+func WithZeroTTLMeansNoExpiry[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.zeroTTLNoExpiry = true
+	}
+}
+
+// WithAnchoredTTL makes overwriting a live entry keep the entry's
+// deadline, so that a TTL counts from the first insertion rather than the
+// latest. The value and LRU position are updated as usual. Once the entry
+// expires, the next insertion starts a new lifetime.
+func WithAnchoredTTL[K comparable, V any]() Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.anchoredTTL = true
+	}
+}
+
+// WithMaxAge caps the lifetime of every entry at maxAge from when it was
+// set, however often its deadline is refreshed by WithRefreshOnGet, Touch
+// or GetExtend. Entries that would otherwise never expire are capped too,
+// and DoStale's grace period doesn't serve an entry past maxAge either.
+func WithMaxAge[K comparable, V any](maxAge time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.maxAge = maxAge
+	}
+}
+
+// WithKeyCost replaces the Coster passed to New with fn, which also sees
+// the entry's key. It suits keys large enough to matter to the cost limit.
+func WithKeyCost[K comparable, V any](fn func(key K, v V) int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.keyCoster = fn
+	}
+}
+
+// WithClock replaces the wall clock used for expiry decisions. It is mostly
+// useful for testing TTL behavior deterministically.
+func WithClock[K comparable, V any](clock Clock) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.clock = clock
+	}
+}
+
+// WithOnEvict registers fn to be called whenever an entry leaves the cache,
+// along with the reason it was removed.
+//
+// fn is called while the cache is locked, so it must not call methods on
+// the cache.
+func WithOnEvict[K comparable, V any](fn func(key K, value V, reason EvictReason)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = fn
+	}
+}
+
+// WithCorruptionHandler registers fn to be called, instead of panicking,
+// when the cache detects that its internal structures disagree. The error
+// wraps ErrCorrupt. The cache then drops the inconsistent entry and
+// carries on.
+//
+// fn is called while the cache is locked, so it must not call methods on
+// the cache.
+func WithCorruptionHandler[K comparable, V any](fn func(err error)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onCorrupt = fn
+	}
+}
+
+// WithMaxEntries limits the number of entries in the cache, independent of
+// the cost limit. When either limit is exceeded, least-recently-used entries
+// are evicted. Use -1 to disable the limit, which is the default.
+func WithMaxEntries[K comparable, V any](n int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.maxEntries = n
+	}
+}
+
+// WithPolicy selects the eviction policy used when the cache is over its
+// limits. The default is LRU.
+func WithPolicy[K comparable, V any](p Policy) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.policy = p
+	}
+}
+
+// WithOversize selects what happens to values that cost more than the
+// cost limit on their own. The default is OversizeKeep.
+func WithOversize[K comparable, V any](o Oversize) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.oversize = o
+	}
+}
+
+// WithCostTTL derives the TTL of every stored entry from its cost by
+// calling fn with the cost and the TTL the entry would otherwise get, for
+// example to let expensive entries expire sooner. Deadline refreshes by
+// WithRefreshOnGet, Touch and GetExtend are not passed through fn.
+func WithCostTTL[K comparable, V any](fn func(cost int, ttl time.Duration) time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.costTTL = fn
+	}
+}
+
+// WithAdmission enables a TinyLFU admission policy. The cache tracks the
+// approximate access frequency of keys, including misses, and when storing
+// a new entry would evict another, the new entry is only admitted if it is
+// more popular than the victim. This protects hot entries from being
+// flushed out by scans of keys that are used once.
+//
+// hash must be a well-distributed Hasher for the key type, and size should
+// approximate the number of entries the cache holds.
+func WithAdmission[K comparable, V any](hash Hasher[K], size int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.admission = cmsketch.New(size)
+		c.admissionHash = hash
+	}
+}
+
+// WithJitter randomly scales every positive TTL by up to ±fraction, so that
+// entries stored together do not all expire at once. For example, a
+// fraction of 0.1 spreads a 60s TTL across 54s to 66s. fraction must be in
+// [0, 1), so that jittered TTLs stay positive; WithJitter panics otherwise.
+// Jittered TTLs are capped at the longest representable duration.
+//
+// Each cache draws random numbers from its own generator, seeded from r
+// when the option is applied, so r may be seeded for reproducible tests.
+// r is not used afterwards, which lets the shards of a ShardedCache share
+// the option. If r is nil, a time-seeded source is used.
+func WithJitter[K comparable, V any](fraction float64, r *rand.Rand) Option[K, V] {
+	if !(fraction >= 0 && fraction < 1) {
+		panic("tlru: jitter fraction must be in [0, 1)")
+	}
+	return func(c *Cache[K, V]) {
+		c.jitter = fraction
+		seed := time.Now().UnixNano()
+		if r != nil {
+			seed = r.Int63()
+		}
+		c.jitterRand = rand.New(rand.NewSource(seed))
+	}
+}
@@ -0,0 +1,141 @@
+package tlru
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// persistedEntry is the gob representation of a cache entry.
+type persistedEntry[K comparable, V any] struct {
+	Key      K
+	Value    V
+	Deadline time.Time
+}
+
+// MarshalBinary encodes the live entries of the cache, in LRU order, using
+// encoding/gob. K and V must be gob-encodable.
+func (l *Cache[K, V]) MarshalBinary() ([]byte, error) {
+	items := l.Items()
+	entries := make([]persistedEntry[K, V], len(items))
+	for i, it := range items {
+		entries[i] = persistedEntry[K, V]{
+			Key:      it.Key,
+			Value:    it.Value,
+			Deadline: it.Deadline,
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entries); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the contents of the cache with entries encoded
+// by MarshalBinary. Entries whose deadline has passed are skipped, and LRU
+// order is preserved.
+func (l *Cache[K, V]) UnmarshalBinary(data []byte) error {
+	var entries []persistedEntry[K, V]
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entries); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clear()
+	now := l.clock.Now()
+	for _, e := range entries {
+		if !e.Deadline.IsZero() && !e.Deadline.After(now) {
+			continue
+		}
+		l.set(e.Key, e.Value, e.Deadline)
+	}
+	return nil
+}
+
+// maxWarmRecord bounds the length of a record read by WarmFrom, so that a
+// corrupt length prefix cannot make it allocate without limit.
+const maxWarmRecord = 64 << 20
+
+// WarmFrom adds entries read from r without clearing the cache. r holds a
+// sequence of records, each a uvarint length followed by that many bytes,
+// which decode turns into an entry and its TTL. Entries that have already
+// expired are skipped. Records are read one at a time, so the whole
+// snapshot is never held in memory, and decode must not retain the slice
+// it is passed. Records longer than 64 MiB are rejected as corrupt.
+func (l *Cache[K, V]) WarmFrom(r io.Reader, decode func([]byte) (K, V, time.Duration, error)) error {
+	br := bufio.NewReader(r)
+	var buf bytes.Buffer
+	for {
+		n, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if n > maxWarmRecord {
+			return fmt.Errorf("tlru: record length %d exceeds %d bytes", n, maxWarmRecord)
+		}
+		// Copying rather than preallocating n bytes means a truncated
+		// snapshot only costs as much memory as it holds.
+		buf.Reset()
+		if _, err := io.CopyN(&buf, br, int64(n)); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		key, v, ttl, err := decode(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		l.warm(key, v, ttl)
+	}
+}
+
+func (l *Cache[K, V]) warm(key K, v V, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	deadline := l.deadline(ttl)
+	if !deadline.IsZero() && !deadline.After(l.clock.Now()) {
+		return
+	}
+	l.set(key, v, deadline)
+}
+
+// dumpedEntry is the JSON representation of an entry written by DumpJSON.
+type dumpedEntry[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+	// Deadline is empty for entries that never expire.
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// DumpJSON writes the live entries of the cache to w, in LRU order, as
+// newline-delimited JSON objects holding each entry's key, value and
+// RFC 3339 deadline. K and V must be JSON-marshalable. The output is meant
+// for inspection and cannot be loaded back.
+func (l *Cache[K, V]) DumpJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, it := range l.Items() {
+		e := dumpedEntry[K, V]{Key: it.Key, Value: it.Value}
+		if !it.Deadline.IsZero() {
+			e.Deadline = it.Deadline.Format(time.RFC3339Nano)
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package tlru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_MarshalBinary(t *testing.T) {
+	clock := newFakeClock()
+	c := New(ConstantCost[string], 10, WithClock[string, string](clock))
+	c.Set("a", "1", time.Hour)
+	c.Set("b", "2", time.Minute)
+	c.Set("c", "3", time.Hour)
+	c.Get("a")
+
+	data, err := c.MarshalBinary()
+	require.NoError(t, err)
+
+	clock.Advance(time.Minute)
+	restored := New(ConstantCost[string], 10, WithClock[string, string](clock))
+	restored.Set("stale", "x", time.Hour)
+	require.NoError(t, restored.UnmarshalBinary(data))
+
+	// "b" expired in the meantime, and LRU order is kept.
+	require.Equal(t, []string{"c", "a"}, restored.Keys())
+	v, deadline, ok := restored.Get("a")
+	require.True(t, ok)
+	require.Equal(t, "1", v)
+	require.True(t, deadline.Equal(clock.Now().Add(time.Hour-time.Minute)))
+
+	require.Error(t, restored.UnmarshalBinary([]byte("garbage")))
+}
+
+func TestCache_WarmFrom(t *testing.T) {
+	var buf []byte
+	for _, rec := range []string{"a=1h", "b=0s", "c=1m"} {
+		buf = binary.AppendUvarint(buf, uint64(len(rec)))
+		buf = append(buf, rec...)
+	}
+	decode := func(b []byte) (string, string, time.Duration, error) {
+		k, ttl, _ := strings.Cut(string(b), "=")
+		d, err := time.ParseDuration(ttl)
+		return k, strings.ToUpper(k), d, err
+	}
+
+	c := New[string](ConstantCost[string], 10)
+	c.Set("existing", "x", time.Hour)
+	require.NoError(t, c.WarmFrom(bytes.NewReader(buf), decode))
+	// The already-expired "b" is skipped.
+	require.Equal(t, []string{"existing", "a", "c"}, c.Keys())
+	v, _, _ := c.Get("c")
+	require.Equal(t, "C", v)
+
+	// A truncated record is reported.
+	err := c.WarmFrom(bytes.NewReader(buf[:len(buf)-1]), decode)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// A corrupt length prefix is rejected rather than allocated.
+	huge := binary.AppendUvarint(nil, 1<<62)
+	require.Error(t, c.WarmFrom(bytes.NewReader(huge), decode))
+	large := binary.AppendUvarint(nil, maxWarmRecord)
+	err = c.WarmFrom(bytes.NewReader(append(large, "a=1h"...)), decode)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	wantErr := errors.New("bad record")
+	err = c.WarmFrom(bytes.NewReader(buf), func([]byte) (string, string, time.Duration, error) {
+		return "", "", 0, wantErr
+	})
+	require.ErrorIs(t, err, wantErr)
+}
+
+func TestCache_DumpJSON(t *testing.T) {
+	clock := newFakeClock()
+	c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+	c.Set("a", 1, time.Hour)
+	c.SetPermanent("b", 2)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.DumpJSON(&buf))
+	deadline := clock.Now().Add(time.Hour).Format(time.RFC3339Nano)
+	require.Equal(t,
+		`{"key":"a","value":1,"deadline":"`+deadline+`"}`+"\n"+
+			`{"key":"b","value":2}`+"\n",
+		buf.String(),
+	)
+
+	bad := New(ConstantCost[func()], 10, WithClock[string, func()](clock))
+	bad.Set("f", func() {}, time.Hour)
+	require.Error(t, bad.DumpJSON(&buf))
+}
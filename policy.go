@@ -0,0 +1,69 @@
+package tlru
+
+// Policy selects which live entry is evicted when the cache is over its
+// limits.
+type Policy int
+
+const (
+	// LRU evicts the least-recently-used entry. It is the default.
+	LRU Policy = iota
+	// LFU evicts the least-frequently-used entry, breaking ties in favor of
+	// the more recently used entry. It protects a small set of hot keys
+	// from bursts of one-off lookups, at the cost of extra bookkeeping on
+	// every access.
+	LFU
+)
+
+// Oversize selects what happens to a value that costs more than the cost
+// limit on its own. Any existing entry for its key is removed regardless.
+type Oversize int
+
+const (
+	// OversizeKeep evicts every other entry and stores the value, leaving
+	// the cache over its limit until the next insertion. It is the
+	// default.
+	OversizeKeep Oversize = iota
+	// OversizeReject declines to store the value, counting it in
+	// Stats.Rejections. Other entries are left alone.
+	OversizeReject
+	// OversizeEvict stores the value and evicts it right away with
+	// ReasonCostOverage, so that eviction callbacks see it. Other entries
+	// are left alone.
+	OversizeEvict
+)
+
+// usage is the element type of the lfuHeap.
+type usage[K comparable] struct {
+	// freq counts the number of times the entry was set or retrieved.
+	freq uint64
+	// used mirrors dataWithKey.used, for tie-breaking on recency.
+	used uint64
+	key  K
+}
+
+func usedLess[K comparable](a, b usage[K]) bool {
+	if a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.used < b.used
+}
+
+// victim returns the key of the next live entry to evict under the cache's
+// policy.
+func (l *Cache[K, V]) victim() (K, bool) {
+	if l.lfuHeap != nil {
+		least, ok := l.lfuHeap.Min()
+		if !ok {
+			var zero K
+			return zero, false
+		}
+		return least.Value.key, true
+	}
+
+	last := l.lruList.Tail()
+	if last == nil {
+		var zero K
+		return zero, false
+	}
+	return last.Data.key, true
+}
@@ -0,0 +1,91 @@
+package tlru
+
+import "github.com/armon/go-radix"
+
+// keySet is a secondary index over the keys of a Cache.
+type keySet[K comparable] interface {
+	insert(key K)
+	remove(key K)
+	reset()
+}
+
+// radixKeys is a keySet that supports prefix lookups.
+type radixKeys struct {
+	tree *radix.Tree
+}
+
+func (r *radixKeys) insert(key string) {
+	r.tree.Insert(key, nil)
+}
+
+func (r *radixKeys) remove(key string) {
+	r.tree.Delete(key)
+}
+
+func (r *radixKeys) reset() {
+	r.tree = radix.New()
+}
+
+// prefixed returns every key that starts with prefix, in lexical order.
+func (r *radixKeys) prefixed(prefix string) []string {
+	var keys []string
+	r.tree.WalkPrefix(prefix, func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return false
+	})
+	return keys
+}
+
+// PrefixCache is a Cache with string keys that also supports operations on
+// every key sharing a prefix, such as the keys of a namespace like
+// "user:123:". It maintains a radix tree of its keys, which costs some
+// memory and write throughput.
+type PrefixCache[V any] struct {
+	*Cache[string, V]
+	keys *radixKeys
+}
+
+// NewPrefix instantiates a PrefixCache. Its arguments are the same as New's.
+func NewPrefix[V any](cost Coster[V], costLimit int, opts ...Option[string, V]) *PrefixCache[V] {
+	keys := &radixKeys{tree: radix.New()}
+	c := New(cost, costLimit, opts...)
+	c.keys = keys
+	return &PrefixCache[V]{Cache: c, keys: keys}
+}
+
+// GetByPrefix returns the values of all live entries whose key starts with
+// prefix. Like Peek, it does not mark entries as recently used.
+func (p *PrefixCache[V]) GetByPrefix(prefix string) map[string]V {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	vs := make(map[string]V)
+	now := p.clock.Now()
+	for _, key := range p.keys.prefixed(prefix) {
+		node := p.index[key]
+		if !node.Data.expired(now) {
+			vs[key] = node.Data.data
+		}
+	}
+	return vs
+}
+
+// DeleteByPrefix removes every entry whose key starts with prefix,
+// returning the number of live entries removed. The OnEvict callback, if
+// any, is invoked with ReasonManual.
+func (p *PrefixCache[V]) DeleteByPrefix(prefix string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var n int
+	now := p.clock.Now()
+	for _, key := range p.keys.prefixed(prefix) {
+		if p.index[key].Data.expired(now) {
+			p.delete(key, ReasonExpired)
+			continue
+		}
+		p.delete(key, ReasonManual)
+		n++
+	}
+	return n
+}
@@ -0,0 +1,39 @@
+package tlru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixCache(t *testing.T) {
+	clock := newFakeClock()
+	c := NewPrefix(ConstantCost[int], 4, WithClock[string, int](clock))
+	c.Set("user:1:name", 1, time.Hour)
+	c.Set("user:1:age", 2, time.Hour)
+	c.Set("user:2:name", 3, time.Hour)
+	c.Set("user:1:expired", 4, time.Second)
+	clock.Advance(time.Minute)
+
+	require.Equal(t, map[string]int{
+		"user:1:name": 1,
+		"user:1:age":  2,
+	}, c.GetByPrefix("user:1:"))
+	require.Len(t, c.GetByPrefix("user:"), 3)
+	require.Empty(t, c.GetByPrefix("group:"))
+
+	// Evicted keys leave the prefix index.
+	c.Set("user:3:name", 5, time.Hour)
+	c.Set("user:4:name", 6, time.Hour)
+	require.Equal(t, map[string]int{"user:1:age": 2}, c.GetByPrefix("user:1:"))
+
+	require.Equal(t, 1, c.DeleteByPrefix("user:1:"))
+	require.Equal(t, 3, c.Len())
+	require.Empty(t, c.GetByPrefix("user:1:"))
+
+	c.Clear()
+	require.Empty(t, c.GetByPrefix(""))
+	c.Set("user:1:name", 1, time.Hour)
+	require.Len(t, c.GetByPrefix(""), 1)
+}
@@ -0,0 +1,29 @@
+package tlru
+
+import "time"
+
+// ReadThrough serves values from a Cache, loading and storing them on a
+// miss. Concurrent misses for the same key share a single load.
+type ReadThrough[K comparable, V any] struct {
+	c    *Cache[K, V]
+	load func(key K) (V, time.Duration, error)
+}
+
+// NewReadThrough instantiates a ReadThrough over c. load returns the value
+// for a key along with its TTL; as with DoTTL, NoCache returns the value
+// without caching it, and errors are never cached.
+func NewReadThrough[K comparable, V any](c *Cache[K, V], load func(key K) (V, time.Duration, error)) *ReadThrough[K, V] {
+	return &ReadThrough[K, V]{c: c, load: load}
+}
+
+// Get returns the value for key, loading it if it isn't cached.
+func (r *ReadThrough[K, V]) Get(key K) (V, error) {
+	return r.c.DoTTL(key, func() (V, time.Duration, error) {
+		return r.load(key)
+	})
+}
+
+// Cache returns the underlying cache, for invalidation and inspection.
+func (r *ReadThrough[K, V]) Cache() *Cache[K, V] {
+	return r.c
+}
@@ -0,0 +1,42 @@
+package tlru
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadThrough(t *testing.T) {
+	clock := newFakeClock()
+	c := New(ConstantCost[string], 10, WithClock[int, string](clock))
+
+	var loads int
+	wantErr := errors.New("negative")
+	r := NewReadThrough(c, func(key int) (string, time.Duration, error) {
+		loads++
+		if key < 0 {
+			return "", 0, wantErr
+		}
+		return strconv.Itoa(key), time.Minute, nil
+	})
+
+	v, err := r.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, "1", v)
+	v, err = r.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, "1", v)
+	require.Equal(t, 1, loads)
+
+	_, err = r.Get(-1)
+	require.ErrorIs(t, err, wantErr)
+	require.False(t, r.Cache().Contains(-1))
+
+	clock.Advance(time.Minute)
+	_, err = r.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, 3, loads)
+}
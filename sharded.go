@@ -0,0 +1,113 @@
+package tlru
+
+import (
+	"hash/maphash"
+	"time"
+)
+
+// Hasher maps a key to a well-distributed 64-bit hash.
+type Hasher[K comparable] func(key K) uint64
+
+// StringHasher returns a randomly seeded Hasher for string keys.
+func StringHasher() Hasher[string] {
+	seed := maphash.MakeSeed()
+	return func(key string) uint64 {
+		return maphash.String(seed, key)
+	}
+}
+
+// Integer is the set of integer types accepted by IntegerHasher.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// IntegerHasher is a Hasher for integer keys.
+func IntegerHasher[K Integer](key K) uint64 {
+	// splitmix64 finalizer.
+	x := uint64(key)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ShardedCache spreads keys across independent Caches, each with its own
+// lock, so that throughput scales with the number of cores.
+//
+// Eviction decisions are made per shard, so the cache as a whole
+// approximates, rather than exactly follows, the TLRU policy.
+type ShardedCache[K comparable, V any] struct {
+	shards []*Cache[K, V]
+	hash   Hasher[K]
+}
+
+// NewSharded instantiates a ShardedCache with n shards. costLimit is split
+// evenly across the shards; use -1 to disable cost limiting. opts are
+// applied to every shard individually.
+func NewSharded[K comparable, V any](n int, hash Hasher[K], cost Coster[V], costLimit int, opts ...Option[K, V]) *ShardedCache[K, V] {
+	if n < 1 {
+		panic("tlru: shard count must be positive")
+	}
+	if hash == nil {
+		panic("tlru: nil Hasher")
+	}
+	shardLimit := costLimit
+	if costLimit >= 0 {
+		// Round up so that a small limit still leaves room in every shard.
+		shardLimit = (costLimit + n - 1) / n
+	}
+	c := &ShardedCache[K, V]{
+		shards: make([]*Cache[K, V], n),
+		hash:   hash,
+	}
+	for i := range c.shards {
+		c.shards[i] = New(cost, shardLimit, opts...)
+	}
+	return c
+}
+
+func (c *ShardedCache[K, V]) shard(key K) *Cache[K, V] {
+	return c.shards[c.hash(key)%uint64(len(c.shards))]
+}
+
+// Get retrieves a value from the cache, if it exists.
+func (c *ShardedCache[K, V]) Get(key K) (v V, deadline time.Time, exists bool) {
+	return c.shard(key).Get(key)
+}
+
+// Set adds a new value to the cache.
+func (c *ShardedCache[K, V]) Set(key K, v V, ttl time.Duration) {
+	c.shard(key).Set(key, v, ttl)
+}
+
+// Delete removes an entry from the cache, returning cost savings.
+func (c *ShardedCache[K, V]) Delete(key K) int {
+	return c.shard(key).Delete(key)
+}
+
+// Do behaves like Cache.Do on the key's shard.
+func (c *ShardedCache[K, V]) Do(key K, fn func() (V, error), ttl time.Duration) (V, error) {
+	return c.shard(key).Do(key, fn, ttl)
+}
+
+// Len returns the number of live entries across all shards.
+func (c *ShardedCache[K, V]) Len() int {
+	var n int
+	for _, s := range c.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+// Evict removes expired entries from every shard, returning the total cost
+// evicted.
+func (c *ShardedCache[K, V]) Evict() int {
+	var ds int
+	for _, s := range c.shards {
+		ds += s.Evict()
+	}
+	return ds
+}
@@ -0,0 +1,98 @@
+package tlru
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedCache(t *testing.T) {
+	t.Run("Basic", func(t *testing.T) {
+		c := NewSharded(4, StringHasher(), ConstantCost[int], -1)
+		for i := 0; i < 100; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		require.Equal(t, 100, c.Len())
+		for i := 0; i < 100; i++ {
+			v, _, ok := c.Get(strconv.Itoa(i))
+			require.True(t, ok)
+			require.Equal(t, i, v)
+		}
+		require.Equal(t, 1, c.Delete("1"))
+		_, _, ok := c.Get("1")
+		require.False(t, ok)
+
+		v, err := c.Do("new", func() (int, error) { return 7, nil }, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, 7, v)
+	})
+
+	t.Run("Jitter", func(t *testing.T) {
+		// The shards share the option, so they must not share its generator.
+		c := NewSharded(8, IntegerHasher[int], ConstantCost[int], -1,
+			WithJitter[int, int](0.1, rand.New(rand.NewSource(1))),
+		)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					c.Set(g*100+i, i, time.Minute)
+				}
+			}(g)
+		}
+		wg.Wait()
+		require.Equal(t, 800, c.Len())
+	})
+
+	t.Run("CostLimitSplit", func(t *testing.T) {
+		c := NewSharded(4, IntegerHasher[int], ConstantCost[int], 40)
+		for i := 0; i < 1000; i++ {
+			c.Set(i, i, time.Second)
+		}
+		for _, s := range c.shards {
+			require.Equal(t, 10, s.CostLimit())
+			require.LessOrEqual(t, s.Cost(), 10)
+		}
+		require.LessOrEqual(t, c.Len(), 40)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		c := NewSharded(8, IntegerHasher[int], ConstantCost[int], 100)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					c.Set(g*1000+i, i, time.Second)
+					c.Get(g*1000 + i/2)
+				}
+			}(g)
+		}
+		wg.Wait()
+		require.LessOrEqual(t, c.Len(), 104)
+	})
+}
+
+func Benchmark_ShardedCache_GetParallel(b *testing.B) {
+	c := NewSharded(16, StringHasher(), ConstantCost[int], 1000)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "test-key-" + strconv.Itoa(i)
+		c.Set(keys[i], i, time.Hour)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			c.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package tlru
+
+import "sync/atomic"
+
+// Stats is a snapshot of cache activity counters.
+type Stats struct {
+	// Hits and Misses count lookups via Get and the methods built on it.
+	Hits   uint64
+	Misses uint64
+	// Computed counts the number of times Do invoked its compute function.
+	Computed uint64
+	// Insertions counts values stored in the cache.
+	Insertions uint64
+	// Rejections counts values the cache declined to store, either because
+	// of the admission policy or because of OversizeReject.
+	Rejections uint64
+	// Expirations counts entries removed because their deadline passed.
+	Expirations uint64
+	// CostEvictions counts entries removed to satisfy the cost limit.
+	CostEvictions uint64
+	// OverLimit counts the times eviction left the cache over its limits
+	// because nothing else remained to evict, as when a single value costs
+	// more than the whole cost limit.
+	OverLimit uint64
+}
+
+// HitRatio returns the fraction of lookups that were hits, or 0 if there
+// were no lookups.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// stats holds the live counters behind Stats.
+type stats struct {
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	computed      atomic.Uint64
+	insertions    atomic.Uint64
+	rejections    atomic.Uint64
+	expirations   atomic.Uint64
+	costEvictions atomic.Uint64
+	overLimit     atomic.Uint64
+}
+
+func (s *stats) evicted(reason EvictReason) {
+	switch reason {
+	case ReasonExpired:
+		s.expirations.Add(1)
+	case ReasonCostOverage:
+		s.costEvictions.Add(1)
+	}
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		Computed:      s.computed.Load(),
+		Insertions:    s.insertions.Load(),
+		Rejections:    s.rejections.Load(),
+		Expirations:   s.expirations.Load(),
+		CostEvictions: s.costEvictions.Load(),
+		OverLimit:     s.overLimit.Load(),
+	}
+}
+
+func (s *stats) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.computed.Store(0)
+	s.insertions.Store(0)
+	s.rejections.Store(0)
+	s.expirations.Store(0)
+	s.costEvictions.Store(0)
+	s.overLimit.Store(0)
+}
+
+// Stats returns a snapshot of the cache's activity counters.
+func (l *Cache[K, V]) Stats() Stats {
+	return l.stats.snapshot()
+}
+
+// ResetStats zeroes the cache's activity counters without affecting its
+// entries, so that successive Stats snapshots cover independent windows.
+// Each counter is reset atomically, but activity concurrent with the reset
+// may be attributed to either window.
+func (l *Cache[K, V]) ResetStats() {
+	l.stats.reset()
+}
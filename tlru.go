@@ -1,17 +1,24 @@
 package tlru
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
 	"sync"
 	"time"
 
+	"github.com/ammario/tlru/internal/cmsketch"
 	"github.com/ammario/tlru/internal/doublelist"
-	"github.com/armon/go-radix"
+	"github.com/ammario/tlru/internal/minheap"
+	"github.com/ammario/tlru/internal/singleflight"
 )
 
 // Coster is a function that returns the approximate memory cost of a
-// given value.
+// given value. Costs below 1 are treated as 1, so that every entry counts
+// towards the cost limit.
 type Coster[T any] func(v T) int
 
 // ConstantCost always returns 1.
@@ -19,125 +26,512 @@ func ConstantCost[T any](_ T) int {
 	return 1
 }
 
+// ErrCorrupt is wrapped by the errors reported when the cache detects that
+// its internal structures disagree, which indicates a bug in tlru.
+var ErrCorrupt = errors.New("tlru: cache corrupt")
+
+// DefaultTTL may be passed wherever a TTL is expected to use the default TTL
+// configured by WithDefaultTTL. If no default is configured, entries stored
+// with DefaultTTL expire immediately.
+const DefaultTTL time.Duration = -1
+
+// NoCache may be passed to Do, or returned by the function given to DoTTL,
+// to return a computed value without caching it. Unlike a zero TTL, its
+// meaning doesn't depend on WithZeroTTLMeansNoExpiry. Set treats it like
+// any other negative TTL, storing an already-expired entry.
+const NoCache time.Duration = -2
+
+// Entry is a key-value pair with its lifetime, as used by batch operations.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+	// TTL is the lifetime of the entry. SetMany uses it to compute the
+	// deadline; Items reports the time remaining.
+	TTL time.Duration
+	// Deadline is the absolute expiry of the entry. It is populated by
+	// Items and ignored by SetMany.
+	Deadline time.Time
+}
+
 // dataWithKey bundles data with its reference key.
 // This structure allows for reverse lookup from the doubly-linked list to the index.
 type dataWithKey[K comparable, V any] struct {
-	data     V
-	key      K
+	data V
+	key  K
+	// expiry is the entry's position in the ttlHeap, or nil if the entry
+	// never expires.
+	expiry *minheap.Item[expiry[K]]
+	// cost is the entry's cost as of when it was stored, so that deleting
+	// it releases exactly what it added even if the Coster's result drifts.
+	cost int
+	// grace is how long past its deadline the entry is retained so that it
+	// may be served stale.
+	grace time.Duration
+	// stale is the part of grace retained past the current deadline, which
+	// MaxAge may shorten. The ttlHeap orders entries by deadline plus stale.
+	stale time.Duration
+	// inserted is when the entry was set. It is only recorded if the cache
+	// has a MaxAge.
+	inserted time.Time
+	// used is the value of the cache's useSeq when the entry was last
+	// moved to the front of the lruList.
+	used uint64
+	// usage is the entry's position in the lfuHeap, if the LFU policy is
+	// in use.
+	usage *minheap.Item[usage[K]]
+}
+
+// deadline returns the entry's deadline, or the zero time if it never
+// expires.
+func (d dataWithKey[K, V]) deadline() time.Time {
+	if d.expiry == nil {
+		return time.Time{}
+	}
+	return d.expiry.Value.deadline.Add(-d.stale)
+}
+
+// capDeadline limits deadline to maxAge past the entry's insertion. The
+// zero deadline, meaning no expiry, is capped too.
+func (d dataWithKey[K, V]) capDeadline(deadline time.Time, maxAge time.Duration) time.Time {
+	limit := d.inserted.Add(maxAge)
+	if deadline.IsZero() || deadline.After(limit) {
+		return limit
+	}
+	return deadline
+}
+
+// retainUntil returns when the entry may be reclaimed given its deadline:
+// the deadline plus the grace period, shortened so that the entry isn't
+// retained past maxAge from its insertion. It records the result in stale.
+func (d *dataWithKey[K, V]) retainUntil(deadline time.Time, maxAge time.Duration) time.Time {
+	d.stale = d.grace
+	if maxAge > 0 {
+		if limit := d.inserted.Add(maxAge); deadline.Add(d.grace).After(limit) {
+			d.stale = limit.Sub(deadline)
+		}
+	}
+	return deadline.Add(d.stale)
+}
+
+// reclaimable reports whether the entry's grace period has elapsed.
+func (d dataWithKey[K, V]) reclaimable(now time.Time) bool {
+	return d.expiry != nil && !d.expiry.Value.deadline.After(now)
+}
+
+// expired reports whether the entry's deadline has been reached. This
+// matches evictExpires, which reclaims entries once their deadline is no
+// longer in the future.
+func (d dataWithKey[K, V]) expired(now time.Time) bool {
+	return d.expiry != nil && !d.deadline().After(now)
+}
+
+// expiry is the element type of the ttlHeap.
+type expiry[K comparable] struct {
 	deadline time.Time
+	key      K
+}
+
+func expiresBefore[K comparable](a, b expiry[K]) bool {
+	return a.deadline.Before(b.deadline)
 }
 
-// Cache implements a time aware least-frequently-used cache structure.
+// Cache implements a time aware least-recently-used cache structure.
 // When the cache exceeds a given cost limit, the oldest chunks of data are discarded.
 type Cache[K comparable, V any] struct {
-	mu sync.Mutex
+	mu sync.RWMutex
 
 	index map[K]*doublelist.Node[dataWithKey[K, V]]
 	// lruList contains entries in order of least-recently-used to most-recently-used.
 	lruList *doublelist.List[dataWithKey[K, V]]
-	// ttlTrie contains entries in order of expires first to expires last.
-	// Entries are sorted by their UnixNano deadline.
-	ttlTrie *radix.Tree
+	// graced counts entries stored with a grace period.
+	graced int
+	// useSeq is incremented every time an entry moves to the front of the
+	// lruList.
+	useSeq uint64
+	// policy selects how victims are chosen under cost pressure.
+	policy Policy
+	// oversize decides the fate of values costing more than costLimit.
+	oversize Oversize
+	// lfuHeap orders entries from least to most frequently used. It is only
+	// maintained under the LFU policy.
+	lfuHeap *minheap.Heap[usage[K]]
+	// admission, if set, estimates access frequencies so that new entries
+	// are only admitted if they are more popular than the entry they would
+	// evict.
+	admission     *cmsketch.Sketch
+	admissionHash Hasher[K]
+	// ttlHeap orders entries by deadline, with the soonest to expire at the
+	// top. Entries that share a deadline coexist without conflict.
+	ttlHeap *minheap.Heap[expiry[K]]
 	// coster allows for user-defined relative weighting of cache members.
 	coster Coster[V]
-	cost   int
+	// keyCoster, if set, takes precedence over coster.
+	keyCoster func(key K, v V) int
+	cost      int
 	// costLimit sets the maximum storage cost of the cache.
 	costLimit int
+	// maxEntries sets the maximum number of entries in the cache, or -1
+	// for no limit.
+	maxEntries int
+	// refreshOnGet, if non-zero, is the TTL an entry is reset to whenever
+	// it is retrieved via Get.
+	refreshOnGet time.Duration
+	// defaultTTL is used in place of DefaultTTL.
+	defaultTTL time.Duration
+	// minTTL is the floor positive TTLs are raised to.
+	minTTL time.Duration
+	// zeroTTLNoExpiry makes a TTL of zero mean the entry never expires.
+	zeroTTLNoExpiry bool
+	// anchoredTTL makes overwriting a live entry keep its deadline.
+	anchoredTTL bool
+	// maxAge, if positive, caps every deadline at the entry's insertion
+	// time plus maxAge.
+	maxAge time.Duration
+	// clock is the source of the current time for all expiry decisions.
+	clock Clock
+	// jitter is the maximum fraction by which TTLs are randomly scaled.
+	jitter     float64
+	jitterRand *rand.Rand
+	// costTTL, if set, derives the TTL of every stored entry from its cost.
+	costTTL func(cost int, ttl time.Duration) time.Duration
+	// onEvict, if set, is called whenever an entry leaves the cache.
+	onEvict func(key K, value V, reason EvictReason)
+	// events, if set, receives an event whenever an entry leaves the cache.
+	events chan EvictEvent[K, V]
+
+	stats stats
+	// flights deduplicates concurrent computations in Do.
+	flights singleflight.Group[K, V]
+	// evictedSink, if set, collects entries evicted due to expiry or cost
+	// pressure. It is used by SetR.
+	evictedSink *[]Entry[K, V]
+	// deferEviction makes set skip cost eviction, leaving it to the end of
+	// a batch. It is used by SetAll.
+	deferEviction bool
+	// errs holds errors cached by DoWithErrorTTL. It is created lazily.
+	errs *Cache[K, error]
+	// keys, if set, mirrors the keys of the index. It is used by
+	// PrefixCache.
+	keys keySet[K]
+	// onCorrupt, if set, is called instead of panicking when the cache's
+	// internal structures disagree.
+	onCorrupt func(err error)
 }
 
 // New instantiates a ready-to-use LRU cache. It is safe for concurrent use. If cost is nil,
 // a constant cost of 1 is assumed.
 // Use -1 for costLimit to disable cost limiting.
-func New[K comparable, V any](cost Coster[V], costLimit int) *Cache[K, V] {
+//
+// By default, a value that costs more than costLimit on its own evicts
+// every other entry and is then stored anyway, leaving the cache over its
+// limit until the next insertion evicts it. Stats.OverLimit counts such
+// occurrences. WithOversize selects a different behavior.
+func New[K comparable, V any](cost Coster[V], costLimit int, opts ...Option[K, V]) *Cache[K, V] {
 	if cost == nil {
 		cost = ConstantCost[V]
 	}
-	return &Cache[K, V]{
-		index:     make(map[K]*doublelist.Node[dataWithKey[K, V]]),
-		lruList:   &doublelist.List[dataWithKey[K, V]]{},
-		ttlTrie:   radix.New(),
-		coster:    cost,
-		costLimit: costLimit,
+	c := &Cache[K, V]{
+		index:      make(map[K]*doublelist.Node[dataWithKey[K, V]]),
+		lruList:    &doublelist.List[dataWithKey[K, V]]{},
+		ttlHeap:    minheap.New(expiresBefore[K]),
+		coster:     cost,
+		costLimit:  costLimit,
+		maxEntries: -1,
+		clock:      realClock{},
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	if c.policy == LFU {
+		c.lfuHeap = minheap.New(usedLess[K])
+	}
+	return c
 }
 
-// strconv is too expensive
-func parseDeadlineKey(s string) time.Time {
-	return time.Unix(0, int64(binary.BigEndian.Uint64([]byte(s))))
+// Clone returns an independent copy of the cache, with the same entries,
+// LRU order, limits and options. Values are copied by assignment, so
+// reference types still share their underlying data. Stats, the Events
+// channel and any cached errors are not carried over.
+func (l *Cache[K, V]) Clone() *Cache[K, V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := &Cache[K, V]{
+		index:           make(map[K]*doublelist.Node[dataWithKey[K, V]], len(l.index)),
+		lruList:         &doublelist.List[dataWithKey[K, V]]{},
+		graced:          l.graced,
+		useSeq:          l.useSeq,
+		policy:          l.policy,
+		oversize:        l.oversize,
+		admissionHash:   l.admissionHash,
+		ttlHeap:         minheap.New(expiresBefore[K]),
+		coster:          l.coster,
+		keyCoster:       l.keyCoster,
+		cost:            l.cost,
+		costLimit:       l.costLimit,
+		maxEntries:      l.maxEntries,
+		refreshOnGet:    l.refreshOnGet,
+		defaultTTL:      l.defaultTTL,
+		minTTL:          l.minTTL,
+		zeroTTLNoExpiry: l.zeroTTLNoExpiry,
+		anchoredTTL:     l.anchoredTTL,
+		maxAge:          l.maxAge,
+		clock:           l.clock,
+		jitter:          l.jitter,
+		costTTL:         l.costTTL,
+		onEvict:         l.onEvict,
+		onCorrupt:       l.onCorrupt,
+	}
+	if l.lfuHeap != nil {
+		c.lfuHeap = minheap.New(usedLess[K])
+	}
+	if l.admission != nil {
+		c.admission = l.admission.Clone()
+	}
+	if l.jitterRand != nil {
+		// A rand.Rand is not safe to share between caches.
+		c.jitterRand = rand.New(rand.NewSource(l.jitterRand.Int63()))
+	}
+	for node := l.lruList.Tail(); node != nil; node = node.Next() {
+		data := node.Data
+		if data.expiry != nil {
+			data.expiry = c.ttlHeap.Push(data.expiry.Value)
+		}
+		if data.usage != nil {
+			data.usage = c.lfuHeap.Push(data.usage.Value)
+		}
+		c.index[data.key] = c.lruList.Append(data)
+	}
+	return c
 }
 
-func formatDeadlineKey(t time.Time) string {
-	var b [8]byte
-	binary.BigEndian.PutUint64(b[:], uint64(t.UnixNano()))
-	return string(b[:])
+// corrupt reports an internal inconsistency, panicking unless a corruption
+// handler is configured. Callers continue by repairing what they can.
+func (l *Cache[K, V]) corrupt(err error) {
+	if l.onCorrupt == nil {
+		panic(err)
+	}
+	l.onCorrupt(err)
 }
 
-func (l *Cache[K, V]) delete(key K) int {
+func (l *Cache[K, V]) delete(key K, reason EvictReason) int {
 	node, ok := l.index[key]
 	if !ok {
 		return 0
 	}
+	if node.Data.expiry != nil && !l.ttlHeap.Remove(node.Data.expiry) {
+		// Something is very, very wrong. Drop the orphaned entry.
+		l.corrupt(fmt.Errorf("key %+v not in ttlHeap: %w", key, ErrCorrupt))
+	}
+	return l.unlink(node, reason)
+}
+
+// unlink is like delete, but expects the node to have been removed from
+// the ttlHeap already.
+func (l *Cache[K, V]) unlink(node *doublelist.Node[dataWithKey[K, V]], reason EvictReason) int {
+	key := node.Data.key
 	l.lruList.Pop(node)
-	costSaving := l.coster(node.Data.data)
+	costSaving := node.Data.cost
 	l.cost -= costSaving
 
-	deadlineKey := formatDeadlineKey(node.Data.deadline)
-	_, ok = l.ttlTrie.Delete(deadlineKey)
-	if !ok {
-		// Something is very, very wrong.
-		panic(fmt.Sprintf("key %q not deleted? cache corrupt", deadlineKey))
+	if l.lfuHeap != nil {
+		l.lfuHeap.Remove(node.Data.usage)
+	}
+	if node.Data.grace > 0 {
+		l.graced--
 	}
 	delete(l.index, key)
+	if l.keys != nil {
+		l.keys.remove(key)
+	}
+	l.stats.evicted(reason)
+	if l.evictedSink != nil && (reason == ReasonExpired || reason == ReasonCostOverage) {
+		*l.evictedSink = append(*l.evictedSink, Entry[K, V]{
+			Key:      key,
+			Value:    node.Data.data,
+			Deadline: node.Data.deadline(),
+		})
+	}
+	l.notifyEvict(key, node.Data.data, reason)
 	return costSaving
 }
 
 func (l *Cache[K, V]) evictExpires() int {
 	var ds int
-	now := time.Now()
+	now := l.clock.Now()
 	for {
-		deadlineKey, v, ok := l.ttlTrie.Minimum()
+		next, ok := l.ttlHeap.Min()
 		if !ok {
 			return ds
 		}
 
-		expiresAt := parseDeadlineKey(deadlineKey)
-		if expiresAt.After(now) {
+		if next.Value.deadline.After(now) {
 			// Abort, we have reached valid keys.
 			return ds
 		}
 
-		k := v.(K)
-		ds += l.delete(k)
+		node, ok := l.index[next.Value.key]
+		l.ttlHeap.Remove(next)
+		if !ok || node.Data.expiry != next {
+			// Drop the orphaned deadline rather than spinning on it.
+			l.corrupt(fmt.Errorf("key %+v in ttlHeap but not in index: %w", next.Value.key, ErrCorrupt))
+			continue
+		}
+		ds += l.unlink(node, ReasonExpired)
+	}
+}
+
+// costOf returns the cost of the entry, clamped to at least 1.
+func (l *Cache[K, V]) costOf(key K, v V) int {
+	var cost int
+	if l.keyCoster != nil {
+		cost = l.keyCoster(key, v)
+	} else {
+		cost = l.coster(v)
+	}
+	if cost < 1 {
+		return 1
 	}
+	return cost
 }
 
-func (l *Cache[K, V]) evictOverages() int {
-	if l.costLimit < 0 {
-		return 0
+// overLimit reports whether the cache exceeds its cost or entry limits.
+// pending is the number of entries about to be inserted whose cost is
+// already accounted for.
+func (l *Cache[K, V]) overLimit(pending int) bool {
+	return l.exceeds(l.cost, len(l.index)+pending)
+}
+
+// exceeds reports whether the given cost or number of entries exceeds the
+// cache's limits.
+func (l *Cache[K, V]) exceeds(cost, entries int) bool {
+	if l.costLimit >= 0 && cost > l.costLimit {
+		return true
 	}
+	return l.maxEntries >= 0 && entries > l.maxEntries
+}
+
+// evictOverages evicts entries until the cache fits within its limits.
+// Expired entries are reclaimed before any live entry is evicted.
+func (l *Cache[K, V]) evictOverages(pending int) int {
 	var ds int
-	for l.cost > l.costLimit {
-		last := l.lruList.Tail()
-		if last == nil {
+	if l.overLimit(pending) {
+		ds += l.evictExpires()
+	}
+	if l.lfuHeap == nil {
+		ds += l.evictTail(pending)
+	}
+	for l.overLimit(pending) {
+		victim, ok := l.victim()
+		if !ok {
 			// No data left to evictOverages. Avoid looping forever.
+			l.stats.overLimit.Add(1)
 			return ds
 		}
-		ds += l.delete(last.Data.key)
+		ds += l.delete(victim, ReasonCostOverage)
+	}
+	return ds
+}
+
+// evictOthers evicts every entry but key, for when key alone is over the
+// cost limit. Expired entries are reclaimed as such.
+func (l *Cache[K, V]) evictOthers(key K) int {
+	ds := l.evictExpires()
+	for k := range l.index {
+		if k != key {
+			ds += l.delete(k, ReasonCostOverage)
+		}
+	}
+	l.stats.overLimit.Add(1)
+	return ds
+}
+
+// evictTail evicts entries from the tail of the lruList in a single batch
+// when a large overage makes that cheaper than evicting them one by one.
+// Otherwise, it evicts nothing.
+func (l *Cache[K, V]) evictTail(pending int) int {
+	var (
+		victims []*doublelist.Node[dataWithKey[K, V]]
+		items   []*minheap.Item[expiry[K]]
+	)
+	cost, entries := l.cost, len(l.index)+pending
+	for node := l.lruList.Tail(); node != nil && l.exceeds(cost, entries); node = node.Next() {
+		victims = append(victims, node)
+		if node.Data.expiry != nil {
+			items = append(items, node.Data.expiry)
+		}
+		cost -= node.Data.cost
+		entries--
+	}
+	// Removing k items from the ttlHeap one by one costs O(k log n), while
+	// rebuilding it costs O(n).
+	n := l.ttlHeap.Len()
+	if len(items)*bits.Len(uint(n)) < n {
+		return 0
+	}
+
+	if l.ttlHeap.RemoveMany(items) != len(items) {
+		// Something is very, very wrong. The victims are unlinked all the
+		// same.
+		l.corrupt(fmt.Errorf("victims not in ttlHeap: %w", ErrCorrupt))
+	}
+	var ds int
+	for _, victim := range victims {
+		ds += l.unlink(victim, ReasonCostOverage)
 	}
 	return ds
 }
 
 // Delete removes an entry from the cache, returning cost savings.
+// The OnEvict callback, if any, is invoked with ReasonManual.
 func (l *Cache[K, V]) Delete(key K) int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	l.forgetError(key)
 	_, ok := l.index[key]
 	if !ok {
 		return 0
 	}
 
-	return l.delete(key)
+	return l.delete(key, ReasonManual)
+}
+
+// DeleteFunc removes every live entry for which pred returns true,
+// returning the number of entries removed. The OnEvict callback, if any, is
+// invoked with ReasonManual.
+//
+// The cache is locked for the duration of DeleteFunc, so pred must not call
+// methods on the cache.
+func (l *Cache[K, V]) DeleteFunc(pred func(key K, value V) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictExpires()
+	var n int
+	l.forEachLive(func(node *doublelist.Node[dataWithKey[K, V]]) bool {
+		if pred(node.Data.key, node.Data.data) {
+			l.delete(node.Data.key, ReasonManual)
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// Pop retrieves and removes the value for key in a single operation.
+// Expired entries are reported as absent. The OnEvict callback, if any,
+// is invoked with ReasonPopped.
+func (l *Cache[K, V]) Pop(key K) (v V, exists bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, exists := l.lookup(key)
+	if !exists {
+		return v, false
+	}
+	l.delete(key, ReasonPopped)
+	return node.Data.data, true
 }
 
 // Set adds a new value to the cache.
@@ -146,94 +540,1292 @@ func (l *Cache[K, V]) Set(key K, v V, ttl time.Duration) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	// Remove existing key if it exists.
-	l.delete(key)
+	l.set(key, v, l.deadline(ttl))
+}
+
+// SetR is like Set, but returns the entries evicted by this call, whether
+// because they expired or to satisfy the cost limit. It is a lightweight
+// alternative to WithOnEvict for callers that only occasionally need to
+// react to evictions.
+func (l *Cache[K, V]) SetR(key K, v V, ttl time.Duration) []Entry[K, V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var evicted []Entry[K, V]
+	l.evictedSink = &evicted
+	defer func() {
+		l.evictedSink = nil
+	}()
+	l.set(key, v, l.deadline(ttl))
+	return evicted
+}
+
+// SetDelta is like Set, but returns the net change in aggregate cost: the
+// new value's cost, less that of any value it replaced and of any entries
+// evicted to make room. Summing the results lets callers keep a running
+// total that reconciles with Cost.
+func (l *Cache[K, V]) SetDelta(key K, v V, ttl time.Duration) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	before := l.cost
+	l.set(key, v, l.deadline(ttl))
+	return l.cost - before
+}
+
+// SetMany adds all entries to the cache under a single lock acquisition.
+// Entries are inserted in order, with the same eviction behavior as
+// calling Set for each, so a batch that exceeds the cost limit retains
+// its most recent entries.
+func (l *Cache[K, V]) SetMany(entries []Entry[K, V]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range entries {
+		l.set(e.Key, e.Value, l.deadline(e.TTL))
+	}
+}
+
+// SetAll adds every pair in entries to the cache with the same ttl, under
+// a single lock acquisition. Cost eviction runs once after the whole batch
+// is inserted, so when the batch exceeds the cost limit, which of its
+// entries survive is unspecified.
+func (l *Cache[K, V]) SetAll(entries map[K]V, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.deferEviction = true
+	defer func() {
+		l.deferEviction = false
+	}()
+	for key, v := range entries {
+		l.set(key, v, l.deadline(ttl))
+	}
+	l.evictOverages(0)
+}
+
+// SetDefault adds a new value to the cache using the default TTL
+// configured by WithDefaultTTL.
+func (l *Cache[K, V]) SetDefault(key K, v V) {
+	l.Set(key, v, DefaultTTL)
+}
+
+// SetPermanent adds a new value to the cache that never expires. It leaves
+// the cache only through cost eviction or deletion.
+func (l *Cache[K, V]) SetPermanent(key K, v V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.set(key, v, time.Time{})
+}
+
+// SetWithDeadline adds a new value to the cache that expires at the given
+// absolute deadline. A deadline in the past stores an immediately-expired
+// entry, consistent with a zero TTL passed to Set. Under
+// WithZeroTTLMeansNoExpiry, the zero time stores an entry that never expires.
+func (l *Cache[K, V]) SetWithDeadline(key K, v V, deadline time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if deadline.IsZero() && !l.zeroTTLNoExpiry {
+		deadline = l.clock.Now()
+	}
+	l.set(key, v, deadline)
+}
+
+func (l *Cache[K, V]) set(key K, v V, deadline time.Time) bool {
+	return l.setWithGrace(key, v, deadline, 0)
+}
+
+// setWithGrace stores v such that it expires at deadline but is only
+// reclaimed grace later, allowing it to be served stale in the meantime.
+// It reports whether v is in the cache afterwards, which it isn't if the
+// admission policy or the oversize policy turned it away.
+func (l *Cache[K, V]) setWithGrace(key K, v V, deadline time.Time, grace time.Duration) bool {
+	// Remove existing key if it exists. An entry that already expired is
+	// reported as such rather than as replaced.
+	var (
+		freq      uint64
+		replacing bool
+	)
+	if node, exists := l.index[key]; exists {
+		if node.Data.usage != nil {
+			// Overwriting a value does not reset its popularity.
+			freq = node.Data.usage.Value.freq
+		}
+		if node.Data.expired(l.clock.Now()) {
+			l.delete(key, ReasonExpired)
+		} else {
+			replacing = true
+			if l.anchoredTTL {
+				deadline = node.Data.deadline()
+			}
+			l.delete(key, ReasonReplaced)
+		}
+	}
+	l.recordAccess(key)
+	l.forgetError(key)
 
-	l.cost += l.coster(v)
+	cost := l.costOf(key, v)
+	l.cost += cost
+	if deadline.IsZero() {
+		// Entries that never expire have no use for a grace period.
+		grace = 0
+	} else if l.costTTL != nil && !(replacing && l.anchoredTTL) {
+		now := l.clock.Now()
+		deadline = now.Add(l.costTTL(cost, deadline.Sub(now)))
+	}
+	oversized := l.costLimit >= 0 && cost > l.costLimit
+	if oversized && l.oversize == OversizeReject {
+		l.cost -= cost
+		l.stats.rejections.Add(1)
+		return false
+	}
 	l.evictExpires()
-	l.evictOverages()
+	if !replacing && !l.admit(key) {
+		l.cost -= cost
+		l.stats.rejections.Add(1)
+		return false
+	}
+	if !l.deferEviction && (!oversized || l.oversize != OversizeEvict) {
+		l.evictOverages(1)
+	}
 
-	deadline := time.Now().Add(ttl)
-	var deadlineKey string
+	l.stats.insertions.Add(1)
+	l.useSeq++
+	data := dataWithKey[K, V]{
+		data:  v,
+		key:   key,
+		cost:  cost,
+		grace: grace,
+		used:  l.useSeq,
+	}
+	if l.maxAge > 0 {
+		data.inserted = l.clock.Now()
+		deadline = data.capDeadline(deadline, l.maxAge)
+	}
+	if !deadline.IsZero() {
+		data.expiry = l.ttlHeap.Push(expiry[K]{deadline: data.retainUntil(deadline, l.maxAge), key: key})
+	}
+	if l.lfuHeap != nil {
+		data.usage = l.lfuHeap.Push(usage[K]{freq: freq + 1, used: l.useSeq, key: key})
+	}
+	if grace > 0 {
+		l.graced++
+	}
+	l.index[key] = l.lruList.Append(data)
+	if l.keys != nil {
+		l.keys.insert(key)
+	}
+	if oversized && l.oversize == OversizeEvict {
+		l.delete(key, ReasonCostOverage)
+		return false
+	}
+	return true
+}
 
-	// If we're getting insert conflicts, we bump the deadline in an
-	// exponentially increasing fashion to prevent thrashing.
-	// TODO: We should use a string slice as the value to more cleanly
-	// resolve conflicts.
-	conflictDelay := time.Nanosecond
+// deadline converts ttl into an absolute deadline, resolving DefaultTTL and
+// applying jitter. The zero time means the entry never expires. It must be
+// called with the lock held.
+func (l *Cache[K, V]) deadline(ttl time.Duration) time.Time {
+	if ttl == DefaultTTL {
+		ttl = l.defaultTTL
+	}
+	if ttl == 0 && l.zeroTTLNoExpiry {
+		return time.Time{}
+	}
+	if l.jitter > 0 && ttl > 0 {
+		// Scale ttl by a random factor in [1-jitter, 1+jitter), taking care
+		// not to overflow long TTLs.
+		scaled := float64(ttl) * (1 + l.jitter*(2*l.jitterRand.Float64()-1))
+		if scaled >= math.MaxInt64 {
+			ttl = math.MaxInt64
+		} else {
+			ttl = time.Duration(scaled)
+		}
+	}
+	if ttl > 0 && ttl < l.minTTL {
+		ttl = l.minTTL
+	}
+	return l.clock.Now().Add(ttl)
+}
 
-	// It's possible that multiple keys have the same deadline, in which case
-	// we bump the deadline by a nanosecond.
-	for {
-		deadlineKey = formatDeadlineKey(deadline)
-		_, ok := l.ttlTrie.Get(deadlineKey)
-		if !ok {
-			break
+// moveDeadline repositions an existing node in the ttlHeap, returning the
+// deadline it ends up with once MaxAge is applied. A zero deadline makes
+// the entry never expire.
+func (l *Cache[K, V]) moveDeadline(node *doublelist.Node[dataWithKey[K, V]], deadline time.Time) time.Time {
+	if l.maxAge > 0 {
+		deadline = node.Data.capDeadline(deadline, l.maxAge)
+	}
+	switch {
+	case deadline.IsZero():
+		if node.Data.expiry != nil {
+			l.ttlHeap.Remove(node.Data.expiry)
+			node.Data.expiry = nil
 		}
-		deadline = deadline.Add(conflictDelay)
-		conflictDelay *= 2
+	case node.Data.expiry == nil:
+		node.Data.expiry = l.ttlHeap.Push(expiry[K]{deadline: node.Data.retainUntil(deadline, l.maxAge), key: node.Data.key})
+	default:
+		node.Data.expiry.Value.deadline = node.Data.retainUntil(deadline, l.maxAge)
+		l.ttlHeap.Fix(node.Data.expiry)
 	}
-	_, ok := l.ttlTrie.Insert(deadlineKey, key)
-	if ok {
-		panic(fmt.Sprintf("unexpected update of ttlTrie, cache corrupt: %+v", v))
-	}
-	l.index[key] = l.lruList.Append(
-		dataWithKey[K, V]{
-			data:     v,
-			key:      key,
-			deadline: deadline,
-		},
-	)
+	return deadline
 }
 
-func (l *Cache[K, V]) get(key K) (v V, deadline time.Time, exists bool) {
+// lookup returns the node for key, deleting it if it has expired. Expired
+// entries still within their grace period are reported as absent but kept.
+func (l *Cache[K, V]) lookup(key K) (*doublelist.Node[dataWithKey[K, V]], bool) {
 	node, exists := l.index[key]
 	if !exists {
-		return v, time.Time{}, false
+		return nil, false
 	}
-	if time.Now().After(node.Data.deadline) {
-		l.delete(key)
+	now := l.clock.Now()
+	if node.Data.expired(now) {
+		if node.Data.reclaimable(now) {
+			l.delete(key, ReasonExpired)
+		}
+		return nil, false
+	}
+	return node, true
+}
+
+func (l *Cache[K, V]) get(key K) (v V, deadline time.Time, exists bool) {
+	l.recordAccess(key)
+	node, exists := l.lookup(key)
+	if !exists {
+		l.stats.misses.Add(1)
 		return v, time.Time{}, false
 	}
+	l.stats.hits.Add(1)
+
+	if l.refreshOnGet != 0 && node.Data.expiry != nil {
+		l.moveDeadline(node, l.clock.Now().Add(l.refreshOnGet))
+	}
 
 	l.lruList.Pop(node)
+	l.useSeq++
+	node.Data.used = l.useSeq
+	if node.Data.usage != nil {
+		node.Data.usage.Value.freq++
+		node.Data.usage.Value.used = l.useSeq
+		l.lfuHeap.Fix(node.Data.usage)
+	}
 	l.index[key] = l.lruList.Append(node.Data)
-	return node.Data.data, node.Data.deadline, true
+	return node.Data.data, node.Data.deadline(), true
+}
+
+// getShared attempts to serve a Get while holding only the read lock.
+// It succeeds for misses and for hits on entries that are near enough to
+// the front of the lruList that promoting them would barely change the
+// eviction order. ok is false if the caller must fall back to get.
+func (l *Cache[K, V]) getShared(key K) (v V, deadline time.Time, exists, ok bool) {
+	if l.admission != nil {
+		// Recording the access mutates the sketch.
+		return v, time.Time{}, false, false
+	}
+	node, exists := l.index[key]
+	if !exists {
+		l.stats.misses.Add(1)
+		return v, time.Time{}, false, true
+	}
+	if l.refreshOnGet != 0 || l.policy != LRU || node.Data.expired(l.clock.Now()) {
+		return v, time.Time{}, false, false
+	}
+	// Entries among the most recent quarter of promotions are left in
+	// place, which keeps the LRU order approximately correct.
+	if l.useSeq-node.Data.used >= uint64(len(l.index)/4) {
+		return v, time.Time{}, false, false
+	}
+	l.stats.hits.Add(1)
+	return node.Data.data, node.Data.deadline(), true, true
+}
+
+// GetStale is like Get, but an expired entry that the cache has not yet
+// reclaimed is returned too, with expired set, rather than deleted. The
+// cache reclaims expired entries on writes and Evict, or once the grace
+// period of DoStale ends, so stale values are only available until then.
+// Expired entries are counted as misses and keep their LRU position.
+func (l *Cache[K, V]) GetStale(key K) (v V, deadline time.Time, expired bool, exists bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, ok := l.index[key]
+	if ok && node.Data.expired(l.clock.Now()) {
+		l.recordAccess(key)
+		l.stats.misses.Add(1)
+		return node.Data.data, node.Data.deadline(), true, true
+	}
+	v, deadline, exists = l.get(key)
+	return v, deadline, false, exists
 }
 
 // Get retrieves a value from the cache, if it exists.
+//
+// Most hits only take a read lock, so concurrent Gets for recently used
+// entries do not serialize. As a result, the LRU order is approximate:
+// entries already near the front are not always moved to the very front.
 func (l *Cache[K, V]) Get(key K) (v V, deadline time.Time, exists bool) {
+	l.mu.RLock()
+	v, deadline, exists, ok := l.getShared(key)
+	l.mu.RUnlock()
+	if ok {
+		return v, deadline, exists
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	return l.get(key)
 }
 
-// Do is a helper that retrieves a value from the cache, if it exists, and
-// calls the provided function to compute the value if it does not.
-//
-// The return signature omits deadline and exists for ergonomics.
-func (l *Cache[K, V]) Do(key K, fn func() (V, error), ttl time.Duration) (V, error) {
-	v, _, ok := l.Get(key)
+// GetMany retrieves the values for keys under a single lock acquisition.
+// Misses are omitted from the result. Each hit is bumped as if by Get.
+func (l *Cache[K, V]) GetMany(keys []K) map[K]V {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	vs := make(map[K]V, len(keys))
+	for _, key := range keys {
+		if v, _, ok := l.get(key); ok {
+			vs[key] = v
+		}
+	}
+	return vs
+}
+
+// GetOrSet returns the existing value for key if present, bumping it.
+// Otherwise, it stores v and returns it. loaded is true if the value was
+// already present, and stored is true if v was stored; neither is true if
+// the admission or oversize policy turned v away.
+func (l *Cache[K, V]) GetOrSet(key K, v V, ttl time.Duration) (actual V, loaded, stored bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	actual, _, loaded = l.get(key)
+	if loaded {
+		return actual, true, false
+	}
+	return v, false, l.set(key, v, l.deadline(ttl))
+}
+
+// SetIfAbsent stores v only if no live entry exists for key, returning
+// whether v was stored. An existing entry is left untouched: neither its
+// value, deadline, nor LRU position change. It also returns false if the
+// admission or oversize policy turned v away.
+func (l *Cache[K, V]) SetIfAbsent(key K, v V, ttl time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, exists := l.lookup(key); exists {
+		return false
+	}
+	return l.set(key, v, l.deadline(ttl))
+}
+
+// SetNX is like SetIfAbsent, but when an entry already exists it also
+// returns that entry's deadline, telling the caller how long until the key
+// frees up.
+func (l *Cache[K, V]) SetNX(key K, v V, ttl time.Duration) (existingDeadline time.Time, set bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if node, exists := l.lookup(key); exists {
+		return node.Data.deadline(), false
+	}
+	return time.Time{}, l.set(key, v, l.deadline(ttl))
+}
+
+// Peek retrieves a value from the cache, if it exists, without marking it
+// as recently used. Peek is read-only: it takes only a read lock and leaves
+// expired entries in place for a later eviction, so it suits readers that
+// should never contend with each other.
+func (l *Cache[K, V]) Peek(key K) (v V, deadline time.Time, exists bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	node, ok := l.index[key]
+	if !ok || node.Data.expired(l.clock.Now()) {
+		return v, time.Time{}, false
+	}
+	return node.Data.data, node.Data.deadline(), true
+}
+
+// TTL returns the time remaining until the entry for key expires.
+// It returns false if the key is absent or expired, so the returned
+// duration is never negative. Entries that never expire report zero.
+func (l *Cache[K, V]) TTL(key K) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, exists := l.lookup(key)
+	if !exists {
+		return 0, false
+	}
+	if node.Data.expiry == nil {
+		return 0, true
+	}
+	ttl := node.Data.deadline().Sub(l.clock.Now())
+	if ttl < 0 {
+		return 0, false
+	}
+	return ttl, true
+}
+
+// TryGet is like Get, but returns immediately rather than wait for the
+// cache's lock, for callers that would sooner skip the cache than block.
+// locked reports whether the lock was acquired; if it is false, the lookup
+// was not performed. Frequent failures suggest the cache is contended
+// enough to benefit from a ShardedCache.
+func (l *Cache[K, V]) TryGet(key K) (v V, exists, locked bool) {
+	if !l.mu.TryRLock() {
+		return v, false, false
+	}
+	v, _, exists, ok := l.getShared(key)
+	l.mu.RUnlock()
 	if ok {
-		return v, nil
+		return v, exists, true
 	}
 
-	v, err := fn()
-	if err != nil {
-		return v, err
+	if !l.mu.TryLock() {
+		return v, false, false
 	}
+	defer l.mu.Unlock()
 
-	l.Set(key, v, ttl)
-	return v, nil
+	v, _, exists = l.get(key)
+	return v, exists, true
 }
 
-// Evict removes all expired entries from the cache.
-// Bear in mind Set and Delete will also evict entries, so most users should
-// not call Evict directly.
-func (l *Cache[K, V]) Evict() int {
+// GetNoBump is like Get, but does not mark the entry as recently used, so
+// that scans don't disturb the eviction order. Unlike Peek, it counts
+// towards hit and miss stats and deletes the entry if it has expired.
+func (l *Cache[K, V]) GetNoBump(key K) (v V, deadline time.Time, exists bool) {
+	l.mu.RLock()
+	node, ok := l.index[key]
+	if ok && !node.Data.expired(l.clock.Now()) {
+		v, deadline, exists = node.Data.data, node.Data.deadline(), true
+	}
+	l.mu.RUnlock()
+
+	if ok && !exists {
+		// Enforce expiry, which needs the write lock.
+		l.mu.Lock()
+		if node, ok := l.lookup(key); ok {
+			v, deadline, exists = node.Data.data, node.Data.deadline(), true
+		}
+		l.mu.Unlock()
+	}
+
+	if exists {
+		l.stats.hits.Add(1)
+	} else {
+		l.stats.misses.Add(1)
+	}
+	return v, deadline, exists
+}
+
+// GetExtend is like Get, but on a hit also pushes the entry's deadline
+// back by extend, returning the new deadline. It saves the extra lock
+// round-trip of a separate Touch. Entries that never expire are left as
+// they are.
+func (l *Cache[K, V]) GetExtend(key K, extend time.Duration) (v V, deadline time.Time, exists bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	v, deadline, exists = l.get(key)
+	if !exists || deadline.IsZero() {
+		return v, deadline, exists
+	}
+	deadline = l.moveDeadline(l.index[key], deadline.Add(extend))
+	return v, deadline, true
+}
+
+// Touch resets the deadline of an existing entry to now plus ttl, leaving
+// its value, cost, and LRU position unchanged. It returns false if the
+// key is absent or expired.
+func (l *Cache[K, V]) Touch(key K, ttl time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, exists := l.lookup(key)
+	if !exists {
+		return false
+	}
+	l.moveDeadline(node, l.deadline(ttl))
+	return true
+}
+
+// UpdateValue replaces the value of an existing entry with fn applied to
+// it, leaving its deadline and LRU position unchanged. The aggregate cost
+// is adjusted by the difference in cost, evicting entries if the cache is
+// then over its limit. It returns false if the key is absent or expired,
+// or if the entry itself was evicted to fit the new value.
+//
+// A new value that costs more than the cost limit on its own is handled as
+// selected by WithOversize: OversizeReject keeps the old value, and
+// OversizeEvict evicts the entry.
+//
+// The cache is locked while fn runs, so fn must not call methods on the
+// cache.
+func (l *Cache[K, V]) UpdateValue(key K, fn func(old V) V) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, exists := l.lookup(key)
+	if !exists {
+		return false
+	}
+	v := fn(node.Data.data)
+	cost := l.costOf(key, v)
+	oversized := l.costLimit >= 0 && cost > l.costLimit
+	if oversized && l.oversize == OversizeReject {
+		l.stats.rejections.Add(1)
+		return false
+	}
+	l.cost += cost - node.Data.cost
+	node.Data.data, node.Data.cost = v, cost
+	switch {
+	case !oversized:
+		l.evictOverages(0)
+	case l.oversize == OversizeEvict:
+		l.delete(key, ReasonCostOverage)
+		return false
+	default:
+		l.evictOthers(key)
+	}
+	_, exists = l.index[key]
+	return exists
+}
+
+// NextExpiry returns the deadline of the entry that expires soonest, or
+// false if no entry expires. The deadline may already have passed if that
+// entry has not been evicted yet, as with entries served stale by DoStale.
+// While such entries are cached, NextExpiry scans every entry.
+func (l *Cache[K, V]) NextExpiry() (time.Time, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.graced == 0 {
+		next, ok := l.ttlHeap.Min()
+		if !ok {
+			return time.Time{}, false
+		}
+		return next.Value.deadline, true
+	}
+	// The ttlHeap is ordered by the end of the grace period, not the
+	// deadline.
+	var next time.Time
+	for node := l.lruList.Tail(); node != nil; node = node.Next() {
+		deadline := node.Data.deadline()
+		if !deadline.IsZero() && (next.IsZero() || deadline.Before(next)) {
+			next = deadline
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// ExpiredCount returns the number of expired entries awaiting eviction,
+// without deleting them, including entries being served stale by DoStale.
+// It only visits the expired entries and their immediate neighbours in the
+// TTL index, so it is cheap while the backlog is small, but it scans every
+// entry while entries with a grace period are cached.
+func (l *Cache[K, V]) ExpiredCount() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.expiredCount()
+}
+
+// expiredCount implements ExpiredCount. It must be called with the lock
+// held.
+func (l *Cache[K, V]) expiredCount() int {
+	var n int
+	now := l.clock.Now()
+	if l.graced > 0 {
+		// The ttlHeap is ordered by the end of the grace period, so it
+		// can't be pruned by deadline.
+		for node := l.lruList.Tail(); node != nil; node = node.Next() {
+			if node.Data.expired(now) {
+				n++
+			}
+		}
+		return n
+	}
+	l.ttlHeap.Walk(func(it *minheap.Item[expiry[K]]) bool {
+		if it.Value.deadline.After(now) {
+			return false
+		}
+		n++
+		return true
+	})
+	return n
+}
+
+// PeekOldest returns the least-recently-used live entry, which is the next
+// to be evicted under cost pressure by the LRU policy. Like Peek, it does
+// not mutate the cache.
+func (l *Cache[K, V]) PeekOldest() (key K, v V, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := l.clock.Now()
+	for node := l.lruList.Tail(); node != nil; node = node.Next() {
+		if !node.Data.expired(now) {
+			return node.Data.key, node.Data.data, true
+		}
+	}
+	return key, v, false
+}
+
+// PeekNewest returns the most-recently-used live entry. Like Peek, it does
+// not mutate the cache.
+func (l *Cache[K, V]) PeekNewest() (key K, v V, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := l.clock.Now()
+	for node := l.lruList.Head(); node != nil; node = node.Prev() {
+		if !node.Data.expired(now) {
+			return node.Data.key, node.Data.data, true
+		}
+	}
+	return key, v, false
+}
+
+// Rank returns the position of key in the LRU order, counting live
+// entries from 0 for the most recently used. It walks the list, taking
+// O(n) time, so it is meant for debugging evictions. It returns false if
+// the key is absent or expired. Like Peek, it does not mutate the cache.
+func (l *Cache[K, V]) Rank(key K) (int, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	target, ok := l.index[key]
+	now := l.clock.Now()
+	if !ok || target.Data.expired(now) {
+		return 0, false
+	}
+	var rank int
+	for node := l.lruList.Head(); node != target; node = node.Prev() {
+		if !node.Data.expired(now) {
+			rank++
+		}
+	}
+	return rank, true
+}
+
+// CostOf returns the cost attributed to the live entry for key, as computed
+// by the Coster when the entry was stored.
+func (l *Cache[K, V]) CostOf(key K) (int, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	node, ok := l.index[key]
+	if !ok || node.Data.expired(l.clock.Now()) {
+		return 0, false
+	}
+	return node.Data.cost, true
+}
+
+// Contains reports whether a live entry exists for key.
+// Like Peek, Contains never mutates the cache: it does not bump the entry
+// and leaves expired entries in place for a later eviction.
+func (l *Cache[K, V]) Contains(key K) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	node, ok := l.index[key]
+	if !ok {
+		return false
+	}
+	return !node.Data.expired(l.clock.Now())
+}
+
+// Do is a helper that retrieves a value from the cache, if it exists, and
+// calls the provided function to compute the value if it does not.
+// Concurrent calls for the same key share a single execution of fn, and
+// all of them receive its result. The cache is not locked while fn runs.
+// A ttl of NoCache returns the value without caching it, as does a zero
+// ttl unless WithZeroTTLMeansNoExpiry is set.
+//
+// The return signature omits deadline and exists for ergonomics.
+func (l *Cache[K, V]) Do(key K, fn func() (V, error), ttl time.Duration) (V, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, nil
+	}
+
+	v, err, _ := l.flights.Do(key, l.loader(key, fn, ttl))
+	return v, err
+}
+
+// DoR is like Do, but the returned bool reports whether the value was a
+// cache hit rather than the result of a call to fn, shared or otherwise.
+func (l *Cache[K, V]) DoR(key K, fn func() (V, error), ttl time.Duration) (V, bool, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, true, nil
+	}
+
+	v, err, shared, ran := l.doFlight(key, fn, ttl)
+	return v, !shared && !ran, err
+}
+
+// doFlight runs fn as a flight for key. shared reports whether the result
+// came from another caller's flight, and ran whether fn ran in this one;
+// if neither, a flight completed between the caller's miss and joining,
+// and the value came from the cache.
+func (l *Cache[K, V]) doFlight(key K, fn func() (V, error), ttl time.Duration) (v V, err error, shared, ran bool) {
+	return l.doTTLFlight(key, func() (V, time.Duration, error) {
+		v, err := fn()
+		return v, ttl, err
+	})
+}
+
+// doTTLFlight is like doFlight, but the TTL is chosen by fn.
+func (l *Cache[K, V]) doTTLFlight(key K, fn func() (V, time.Duration, error)) (v V, err error, shared, ran bool) {
+	v, err, shared = l.flights.Do(key, l.ttlLoader(key, func() (V, time.Duration, error) {
+		ran = true
+		return fn()
+	}, 0))
+	return v, err, shared, ran
+}
+
+// Origin describes where a value returned by GetOrCompute came from.
+type Origin int
+
+const (
+	// OriginHit means the value was already cached, possibly by a call to
+	// fn that completed just before this one would have started its own.
+	OriginHit Origin = iota
+	// OriginComputed means the calling goroutine ran fn.
+	OriginComputed
+	// OriginShared means the value came from a concurrent caller's run of
+	// fn.
+	OriginShared
+)
+
+func (o Origin) String() string {
+	switch o {
+	case OriginHit:
+		return "hit"
+	case OriginComputed:
+		return "computed"
+	case OriginShared:
+		return "shared"
+	default:
+		return "unknown"
+	}
+}
+
+// GetOrCompute is like Do, but also reports where the value came from,
+// distinguishing load on the origin from calls coalesced with another
+// caller's.
+func (l *Cache[K, V]) GetOrCompute(key K, fn func() (V, error), ttl time.Duration) (V, Origin, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, OriginHit, nil
+	}
+
+	v, err, shared, ran := l.doFlight(key, fn, ttl)
+	switch {
+	case shared:
+		return v, OriginShared, err
+	case ran:
+		return v, OriginComputed, err
+	default:
+		return v, OriginHit, err
+	}
+}
+
+// DoContext is like Do, but fn receives a context and the wait for it is
+// bounded by ctx. If ctx is done before fn completes, DoContext returns the
+// context's error.
+//
+// Because fn's execution may be shared with other callers, fn receives a
+// context that carries ctx's values but is never cancelled, and it keeps
+// running after ctx is done so that other callers still get its result.
+// The context's error is never cached.
+func (l *Cache[K, V]) DoContext(ctx context.Context, key K, fn func(ctx context.Context) (V, error), ttl time.Duration) (V, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, nil
+	}
+
+	detached := detachedContext{parent: ctx}
+	ch := l.flights.DoChan(key, l.loader(key, func() (V, error) {
+		return fn(detached)
+	}, ttl))
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return v, ctx.Err()
+	}
+}
+
+// DoTimeout is like Do, but gives up waiting for fn after timeout and
+// returns context.DeadlineExceeded. As with DoContext, fn keeps running,
+// and its result is still cached for later callers.
+func (l *Cache[K, V]) DoTimeout(key K, fn func() (V, error), ttl, timeout time.Duration) (V, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return l.DoContext(ctx, key, func(context.Context) (V, error) {
+		return fn()
+	}, ttl)
+}
+
+// DoWithErrorTTL is like Do, but errors returned by fn are cached for
+// errorTTL, during which calls for key return the cached error without
+// invoking fn. Successful values are cached for ttl. Storing or deleting
+// the key drops its cached error. A zero errorTTL disables error caching,
+// making it equivalent to Do.
+func (l *Cache[K, V]) DoWithErrorTTL(key K, fn func() (V, error), ttl, errorTTL time.Duration) (V, error) {
+	if errorTTL == 0 {
+		return l.Do(key, fn, ttl)
+	}
+
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, nil
+	}
+
+	errs := l.errorCache()
+	if err, _, ok := errs.Get(key); ok {
+		return v, err
+	}
+
+	v, err, _ := l.flights.Do(key, l.loader(key, func() (V, error) {
+		// A previous flight may have failed while we were queued.
+		if err, _, ok := errs.Peek(key); ok {
+			var zero V
+			return zero, err
+		}
+
+		v, err := fn()
+		if err != nil {
+			errs.Set(key, err, errorTTL)
+		}
+		return v, err
+	}, ttl))
+	return v, err
+}
+
+// DoStale is like Do, but implements stale-while-revalidate: values are
+// fresh for ttl and may then be served stale for up to staleFor. When a
+// stale value is found, it is returned immediately while a single
+// background call to fn refreshes it. Errors from background refreshes are
+// discarded, leaving the stale value in place.
+//
+// Stale values are invisible to the rest of the cache's methods, which
+// treat them as expired.
+func (l *Cache[K, V]) DoStale(key K, fn func() (V, error), ttl, staleFor time.Duration) (V, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, nil
+	}
+
+	load := l.graceLoader(key, fn, ttl, staleFor)
+	if v, ok := l.stale(key); ok {
+		l.flights.Go(key, load)
+		return v, nil
+	}
+
+	v, err, _ := l.flights.Do(key, load)
+	return v, err
+}
+
+// DoTTL is like Do, but fn also returns the TTL of the value it computes,
+// so that each value may set its own lifetime. As with Do, NoCache, or a
+// zero TTL without WithZeroTTLMeansNoExpiry, returns the value without
+// caching it.
+func (l *Cache[K, V]) DoTTL(key K, fn func() (V, time.Duration, error)) (V, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, nil
+	}
+
+	v, err, _ := l.flights.Do(key, l.ttlLoader(key, fn, 0))
+	return v, err
+}
+
+// DoIf is like Do, but fn also reports whether its value should be
+// cached. Values it declines to cache are returned to the caller, and to
+// any concurrent callers sharing the call, but not stored.
+func (l *Cache[K, V]) DoIf(key K, fn func() (V, bool, error), ttl time.Duration) (V, error) {
+	return l.DoTTL(key, func() (V, time.Duration, error) {
+		v, cache, err := fn()
+		if !cache {
+			return v, NoCache, err
+		}
+		return v, ttl, err
+	})
+}
+
+// GetWithLoader is like DoTTL, but the returned bool reports whether the
+// value came from the cache rather than a call to loader.
+func (l *Cache[K, V]) GetWithLoader(key K, loader func() (V, time.Duration, error)) (V, bool, error) {
+	v, _, ok := l.Get(key)
+	if ok {
+		return v, true, nil
+	}
+
+	v, err, shared, ran := l.doTTLFlight(key, loader)
+	return v, !shared && !ran, err
+}
+
+// stale returns the value of an expired entry that is still within its
+// grace period.
+func (l *Cache[K, V]) stale(key K) (v V, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	node, exists := l.index[key]
+	if !exists || node.Data.reclaimable(l.clock.Now()) {
+		return v, false
+	}
+	return node.Data.data, true
+}
+
+// errorCache returns the cache of errors used by DoWithErrorTTL, creating
+// it on first use.
+func (l *Cache[K, V]) errorCache() *Cache[K, error] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.errs == nil {
+		l.errs = New[K, error](nil, l.costLimit, WithClock[K, error](l.clock))
+	}
+	return l.errs
+}
+
+// forgetError drops any error cached for key by DoWithErrorTTL, so that
+// writing or deleting the key lets the next call retry. It must be called
+// with the lock held.
+func (l *Cache[K, V]) forgetError(key K) {
+	if l.errs != nil {
+		l.errs.Delete(key)
+	}
+}
+
+// loader wraps fn so that it stores its result in the cache. The returned
+// function is meant to run as a flight.
+func (l *Cache[K, V]) loader(key K, fn func() (V, error), ttl time.Duration) func() (V, error) {
+	return l.graceLoader(key, fn, ttl, 0)
+}
+
+// graceLoader is like loader, but stores the result with a grace period.
+func (l *Cache[K, V]) graceLoader(key K, fn func() (V, error), ttl, grace time.Duration) func() (V, error) {
+	return l.ttlLoader(key, func() (V, time.Duration, error) {
+		v, err := fn()
+		return v, ttl, err
+	}, grace)
+}
+
+// ttlLoader is like graceLoader, but the TTL is chosen by fn.
+func (l *Cache[K, V]) ttlLoader(key K, fn func() (V, time.Duration, error), grace time.Duration) func() (V, error) {
+	return func() (V, error) {
+		// A flight for this key may have completed between our miss and
+		// joining the group.
+		if v, ok := l.peekValue(key); ok {
+			return v, nil
+		}
+
+		l.stats.computed.Add(1)
+		v, ttl, err := fn()
+		if err != nil || ttl == NoCache || (ttl == 0 && !l.zeroTTLNoExpiry) {
+			return v, err
+		}
+
+		l.mu.Lock()
+		l.setWithGrace(key, v, l.deadline(ttl), grace)
+		l.mu.Unlock()
+		return v, nil
+	}
+}
+
+// peekValue is a locked lookup that neither bumps the entry nor counts
+// towards stats.
+func (l *Cache[K, V]) peekValue(key K) (v V, exists bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node, exists := l.lookup(key)
+	if !exists {
+		return v, false
+	}
+	return node.Data.data, true
+}
+
+// Len returns the number of live entries in the cache.
+// Expired entries are evicted first so that the count matches what
+// Get would report as present.
+func (l *Cache[K, V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictExpires()
+	if l.graced == 0 {
+		return len(l.index)
+	}
+	// Entries being served stale must not be counted.
+	var n int
+	l.forEachLive(func(*doublelist.Node[dataWithKey[K, V]]) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// liveLen returns the number of live entries without evicting anything,
+// so that it is safe under the read lock.
+func (l *Cache[K, V]) liveLen() int {
+	if l.graced == 0 {
+		return len(l.index) - l.expiredCount()
+	}
+	var n int
+	l.forEachLive(func(*doublelist.Node[dataWithKey[K, V]]) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// forEachLive calls fn for each live entry from least-recently-used to
+// most-recently-used, stopping if fn returns false. fn may delete the node
+// it is passed. Callers should evictExpires first; forEachLive only skips
+// the expired entries still within their grace period.
+func (l *Cache[K, V]) forEachLive(fn func(node *doublelist.Node[dataWithKey[K, V]]) bool) {
+	now := l.clock.Now()
+	for node := l.lruList.Tail(); node != nil; {
+		// fn may unlink node, so advance first.
+		next := node.Next()
+		if !node.Data.expired(now) && !fn(node) {
+			return
+		}
+		node = next
+	}
+}
+
+// Cost returns the aggregate cost of all entries held by the cache.
+// Expired entries that have not yet been evicted are included.
+func (l *Cache[K, V]) Cost() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.cost
+}
+
+// CostLimit returns the maximum storage cost of the cache, or -1 if cost
+// limiting is disabled.
+func (l *Cache[K, V]) CostLimit() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.costLimit
+}
+
+// Resize changes the cost limit of the cache, evicting least-recently-used
+// entries until the cache fits within the new limit. It returns the cost
+// evicted. Use -1 for newLimit to disable cost limiting.
+func (l *Cache[K, V]) Resize(newLimit int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.costLimit = newLimit
+	return l.evictOverages(0)
+}
+
+// RecomputeCost re-runs the Coster over every entry, for example after
+// values were mutated in place, then evicts entries if the cache is over
+// its limit. It returns the new aggregate cost.
+func (l *Cache[K, V]) RecomputeCost() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.recomputeCost()
+	l.evictOverages(0)
+	return l.cost
+}
+
+// SetCoster replaces the Coster, recomputing the aggregate cost under the
+// new function and evicting entries if the cache is then over its limit.
+// If c is nil, a constant cost of 1 is assumed. It replaces any cost
+// function set by WithKeyCost.
+func (l *Cache[K, V]) SetCoster(c Coster[V]) {
+	if c == nil {
+		c = ConstantCost[V]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.coster, l.keyCoster = c, nil
+	l.recomputeCost()
+	l.evictOverages(0)
+}
+
+func (l *Cache[K, V]) recomputeCost() {
+	l.cost = 0
+	for node := l.lruList.Tail(); node != nil; node = node.Next() {
+		node.Data.cost = l.costOf(node.Data.key, node.Data.data)
+		l.cost += node.Data.cost
+	}
+}
+
+// Clear removes all entries from the cache. The OnEvict callback, if any,
+// is invoked for every entry with ReasonManual.
+func (l *Cache[K, V]) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clear()
+}
+
+func (l *Cache[K, V]) clear() {
+	if l.onEvict != nil || l.events != nil {
+		for node := l.lruList.Tail(); node != nil; node = node.Next() {
+			l.notifyEvict(node.Data.key, node.Data.data, ReasonManual)
+		}
+	}
+	// The compiler turns this loop into a map clear, which keeps the
+	// allocated buckets around for reuse.
+	for k := range l.index {
+		delete(l.index, k)
+	}
+	l.lruList = &doublelist.List[dataWithKey[K, V]]{}
+	l.ttlHeap.Clear()
+	if l.keys != nil {
+		l.keys.reset()
+	}
+	l.graced = 0
+	if l.lfuHeap != nil {
+		l.lfuHeap.Clear()
+	}
+	l.cost = 0
+	if l.errs != nil {
+		l.errs.Clear()
+	}
+}
+
+// Keys returns a snapshot of all live keys in the cache, ordered from
+// least-recently-used to most-recently-used.
+func (l *Cache[K, V]) Keys() []K {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictExpires()
+	keys := make([]K, 0, len(l.index))
+	l.forEachLive(func(node *doublelist.Node[dataWithKey[K, V]]) bool {
+		keys = append(keys, node.Data.key)
+		return true
+	})
+	return keys
+}
+
+// FindKeys returns the keys of all live entries whose value satisfies
+// match, ordered from least-recently-used to most-recently-used. It scans
+// every entry.
+//
+// The cache is locked for the duration of FindKeys, so match must not call
+// methods on the cache.
+func (l *Cache[K, V]) FindKeys(match func(value V) bool) []K {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var keys []K
+	l.forEachLive(func(node *doublelist.Node[dataWithKey[K, V]]) bool {
+		if match(node.Data.data) {
+			keys = append(keys, node.Data.key)
+		}
+		return true
+	})
+	return keys
+}
+
+// Snapshot is Items under a name that suits iteration: it copies every
+// live entry out under the lock once, so that the caller can process them
+// without blocking other operations, unlike Range, which holds the lock
+// for every call of its callback. The copy costs memory proportional to
+// the number of entries, on top of the cache itself.
+func (l *Cache[K, V]) Snapshot() []Entry[K, V] {
+	return l.Items()
+}
+
+// Items returns copies of all live entries in the cache, ordered from
+// least-recently-used to most-recently-used. Values are copied by
+// assignment, so reference types still share their underlying data.
+func (l *Cache[K, V]) Items() []Entry[K, V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictExpires()
+	now := l.clock.Now()
+	items := make([]Entry[K, V], 0, len(l.index))
+	l.forEachLive(func(node *doublelist.Node[dataWithKey[K, V]]) bool {
+		e := Entry[K, V]{
+			Key:      node.Data.key,
+			Value:    node.Data.data,
+			Deadline: node.Data.deadline(),
+		}
+		if !e.Deadline.IsZero() {
+			e.TTL = e.Deadline.Sub(now)
+		}
+		items = append(items, e)
+		return true
+	})
+	return items
+}
+
+// Range calls fn for each live entry in the cache, from least-recently-used
+// to most-recently-used. Iteration stops if fn returns false.
+//
+// The cache is locked for the duration of Range, so fn must not call
+// methods on the cache.
+func (l *Cache[K, V]) Range(fn func(key K, value V, deadline time.Time) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictExpires()
+	l.forEachLive(func(node *doublelist.Node[dataWithKey[K, V]]) bool {
+		return fn(node.Data.key, node.Data.data, node.Data.deadline())
+	})
+}
+
+// RangeByExpiry is like Range, but visits entries from the soonest to
+// expire to the latest. Entries stored with a grace period by DoStale are
+// ordered by the end of that period. Entries that never expire are not
+// visited.
+func (l *Cache[K, V]) RangeByExpiry(fn func(key K, value V, deadline time.Time) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictExpires()
+	now := l.clock.Now()
+	l.ttlHeap.Ascend(func(it *minheap.Item[expiry[K]]) bool {
+		node := l.index[it.Value.key]
+		if node.Data.expired(now) {
+			return true
+		}
+		return fn(node.Data.key, node.Data.data, node.Data.deadline())
+	})
+}
+
+// Evict removes all expired entries from the cache.
+// Bear in mind Set and Delete will also evict entries, so most users should
+// not call Evict directly.
+func (l *Cache[K, V]) Evict() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.evictExpires() + l.evictOverages(0)
+}
+
+// EvictExpired is like Evict, but only removes expired entries, leaving
+// the cache over its limit if it already is. It returns the cost reclaimed.
+func (l *Cache[K, V]) EvictExpired() int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	return l.evictExpires() + l.evictOverages()
+	return l.evictExpires()
 }
@@ -1,13 +1,42 @@
 package tlru
 
 import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ammario/tlru/internal/minheap"
 	"github.com/stretchr/testify/require"
 )
 
+// fakeClock is a manually advanced Clock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1e9, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
 func TestTLRU(t *testing.T) {
 	t.Run("OverrideValue", func(t *testing.T) {
 		c := New[string](ConstantCost[int], 10)
@@ -48,6 +77,32 @@ func TestTLRU(t *testing.T) {
 			}
 		}
 	})
+	t.Run("LFU", func(t *testing.T) {
+		c := New(ConstantCost[int], 3, WithPolicy[string, int](LFU))
+		c.Set("hot", 1, time.Second)
+		for i := 0; i < 5; i++ {
+			c.Get("hot")
+		}
+		// A burst of one-off entries must not push out the hot key, even
+		// though it is the least recently used.
+		for i := 0; i < 10; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		require.True(t, c.Contains("hot"))
+		// Among equally cold entries, the least recent is evicted.
+		require.Equal(t, []string{"hot", "8", "9"}, c.Keys())
+
+		// Overwriting keeps the frequency.
+		c.Set("hot", 2, time.Second)
+		c.Set("x", 0, time.Second)
+		c.Set("y", 0, time.Second)
+		require.True(t, c.Contains("hot"))
+
+		c.Delete("hot")
+		c.Clear()
+		require.Equal(t, 0, c.lfuHeap.Len())
+	})
+
 	t.Run("DeleteEntry", func(t *testing.T) {
 		c := New[string](ConstantCost[int], 10)
 		c.Set("a", 10, time.Second)
@@ -61,6 +116,39 @@ func TestTLRU(t *testing.T) {
 		}
 	})
 
+	t.Run("DeleteFunc", func(t *testing.T) {
+		c := New[string](ConstantCost[int], -1)
+		for i := 0; i < 10; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		n := c.DeleteFunc(func(_ string, v int) bool {
+			return v%2 == 0
+		})
+		require.Equal(t, 5, n)
+		require.Equal(t, []string{"1", "3", "5", "7", "9"}, c.Keys())
+		require.Equal(t, 5, c.Cost())
+	})
+
+	t.Run("Pop", func(t *testing.T) {
+		var reasons []EvictReason
+		c := New(ConstantCost[int], 10, WithOnEvict(func(_ string, _ int, reason EvictReason) {
+			reasons = append(reasons, reason)
+		}))
+		c.Set("a", 1, time.Second)
+		v, ok := c.Pop("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		require.Equal(t, []EvictReason{ReasonPopped}, reasons)
+		require.Equal(t, 0, c.Cost())
+
+		_, ok = c.Pop("a")
+		require.False(t, ok)
+
+		c.Set("b", 2, 0)
+		_, ok = c.Pop("b")
+		require.False(t, ok)
+	})
+
 	t.Run("DynamicCost", func(t *testing.T) {
 		c := New[string](
 			func(v string) int {
@@ -85,61 +173,2127 @@ func TestTLRU(t *testing.T) {
 		}
 	})
 
-	t.Run("Do", func(t *testing.T) {
-		c := New[string, int](nil, -1)
+	t.Run("Len", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		require.Equal(t, 0, c.Len())
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		require.Equal(t, 2, c.Len())
+		// Expired entries must not be counted.
+		c.Set("c", 3, 0)
+		require.Equal(t, 2, c.Len())
+		c.Delete("a")
+		require.Equal(t, 1, c.Len())
+	})
 
-		n := 10
-		fn := func() (int, error) {
-			n += 1
-			return n, nil
+	t.Run("Cost", func(t *testing.T) {
+		c := New[string](
+			func(v string) int {
+				return len(v)
+			},
+			100,
+		)
+		require.Equal(t, 100, c.CostLimit())
+		require.Equal(t, 0, c.Cost())
+		c.Set("a", "abc", time.Second)
+		c.Set("b", "de", time.Second)
+		require.Equal(t, 5, c.Cost())
+		c.Delete("a")
+		require.Equal(t, 2, c.Cost())
+	})
+
+	t.Run("Peek", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 2)
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		v, _, ok := c.Peek("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		// Peek must not protect "a" from eviction.
+		c.Set("c", 3, time.Second)
+		_, _, ok = c.Peek("a")
+		require.False(t, ok)
+		_, _, ok = c.Peek("b")
+		require.True(t, ok)
+	})
+
+	t.Run("ExpiredCount", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], -1, WithClock[string, int](clock))
+		for i := 0; i < 10; i++ {
+			c.Set(strconv.Itoa(i), i, time.Duration(i+1)*time.Second)
 		}
+		require.Equal(t, 0, c.ExpiredCount())
 
-		v, err := c.Do("a", fn, time.Second)
-		require.NoError(t, err)
+		clock.Advance(time.Second * 4)
+		require.Equal(t, 4, c.ExpiredCount())
+		// Counting does not evict.
+		require.Equal(t, 4, c.ExpiredCount())
+		require.Equal(t, 4, c.Evict())
+		require.Equal(t, 0, c.ExpiredCount())
+	})
 
-		require.Equal(t, 11, v)
+	t.Run("PeekOldest", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		_, _, ok := c.PeekOldest()
+		require.False(t, ok)
 
-		v, err = c.Do("a", fn, time.Second)
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Hour)
+		k, v, ok := c.PeekOldest()
+		require.True(t, ok)
+		require.Equal(t, "a", k)
+		require.Equal(t, 1, v)
+
+		// Expired entries are skipped.
+		clock.Advance(time.Minute)
+		k, _, ok = c.PeekOldest()
+		require.True(t, ok)
+		require.Equal(t, "b", k)
+		// Peeking does not promote.
+		k, _, _ = c.PeekOldest()
+		require.Equal(t, "b", k)
+	})
+
+	t.Run("PeekNewest", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		_, _, ok := c.PeekNewest()
+		require.False(t, ok)
+
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Second)
+		k, v, ok := c.PeekNewest()
+		require.True(t, ok)
+		require.Equal(t, "c", k)
+		require.Equal(t, 3, v)
+
+		clock.Advance(time.Minute)
+		k, _, _ = c.PeekNewest()
+		require.Equal(t, "b", k)
+		c.Get("a")
+		k, _, _ = c.PeekNewest()
+		require.Equal(t, "a", k)
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		c := New(ConstantCost[int], 10, WithClock[string, int](newFakeClock()))
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Hour)
+
+		snap := c.Snapshot()
+		require.Equal(t, c.Items(), snap)
+		// The cache may be used freely while iterating.
+		for _, e := range snap {
+			c.Set(e.Key, e.Value*10, time.Hour)
+		}
+		v, _, _ := c.Get("b")
+		require.Equal(t, 20, v)
+		require.Equal(t, 2, snap[1].Value)
+	})
+
+	t.Run("Rank", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Second)
+		c.Set("d", 4, time.Hour)
+
+		rank, ok := c.Rank("d")
+		require.True(t, ok)
+		require.Equal(t, 0, rank)
+		rank, _ = c.Rank("a")
+		require.Equal(t, 3, rank)
+
+		// Expired entries are neither ranked nor counted.
+		clock.Advance(time.Minute)
+		_, ok = c.Rank("c")
+		require.False(t, ok)
+		rank, _ = c.Rank("a")
+		require.Equal(t, 2, rank)
+		_, ok = c.Rank("missing")
+		require.False(t, ok)
+	})
+
+	t.Run("PeekReadOnly", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 1, time.Second)
+
+		clock.Advance(time.Minute)
+		_, _, ok := c.Peek("a")
+		require.False(t, ok)
+		// The expired entry is left for the evictor.
+		require.Equal(t, 1, c.Cost())
+		require.Equal(t, 1, c.Evict())
+	})
+
+	t.Run("TryGet", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		c.Set("a", 1, time.Minute)
+
+		v, ok, locked := c.TryGet("a")
+		require.True(t, locked)
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		_, ok, locked = c.TryGet("b")
+		require.True(t, locked)
+		require.False(t, ok)
+
+		// A held lock fails fast.
+		c.mu.Lock()
+		_, ok, locked = c.TryGet("a")
+		c.mu.Unlock()
+		require.False(t, locked)
+		require.False(t, ok)
+	})
+
+	t.Run("GetNoBump", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 2, WithClock[string, int](clock))
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Hour)
+
+		v, _, ok := c.GetNoBump("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		// "a" is not protected from eviction.
+		require.Equal(t, []string{"a", "b"}, c.Keys())
+		require.EqualValues(t, 1, c.Stats().Hits)
+
+		// Expiry is enforced.
+		clock.Advance(time.Minute * 2)
+		_, _, ok = c.GetNoBump("a")
+		require.False(t, ok)
+		require.Equal(t, 1, c.Cost())
+		require.EqualValues(t, 1, c.Stats().Misses)
+	})
+
+	t.Run("GetExtend", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 2, WithClock[string, int](clock))
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Minute)
+		_, deadline, _ := c.Peek("a")
+
+		v, got, ok := c.GetExtend("a", time.Hour)
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		require.Equal(t, deadline.Add(time.Hour), got)
+		// "a" is bumped, so "b" is evicted first.
+		require.Equal(t, []string{"b", "a"}, c.Keys())
+
+		clock.Advance(time.Minute * 2)
+		_, _, ok = c.Get("a")
+		require.True(t, ok)
+		_, _, ok = c.GetExtend("b", time.Hour)
+		require.False(t, ok)
+	})
+
+	t.Run("UpdateValue", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(func(v []int) int {
+			return len(v)
+		}, 4, WithClock[string, []int](clock))
+		c.Set("a", []int{1}, time.Minute)
+		c.Set("b", []int{2}, time.Minute)
+		_, deadline, _ := c.Peek("a")
+
+		clock.Advance(time.Second)
+		require.True(t, c.UpdateValue("a", func(old []int) []int {
+			return append(old, 3)
+		}))
+		v, got, ok := c.Peek("a")
+		require.True(t, ok)
+		require.Equal(t, []int{1, 3}, v)
+		require.Equal(t, deadline, got)
+		require.Equal(t, 3, c.Cost())
+		// "a" is still least recently used.
+		require.Equal(t, []string{"a", "b"}, c.Keys())
+
+		require.False(t, c.UpdateValue("missing", func(old []int) []int {
+			return old
+		}))
+
+		// Growing the least recently used entry past the limit evicts it.
+		c.Set("c", []int{4}, time.Minute)
+		require.False(t, c.UpdateValue("a", func(old []int) []int {
+			return append(old, 5)
+		}))
+		require.False(t, c.Contains("a"))
+		require.Equal(t, 2, c.Cost())
+	})
+
+	t.Run("UpdateValueOversize", func(t *testing.T) {
+		for name, o := range map[string]Oversize{
+			"Keep":   OversizeKeep,
+			"Reject": OversizeReject,
+			"Evict":  OversizeEvict,
+		} {
+			o := o
+			t.Run(name, func(t *testing.T) {
+				var evicted []EvictReason
+				c := New(
+					func(v int) int {
+						return v
+					},
+					10,
+					WithOversize[string, int](o),
+					WithOnEvict(func(_ string, _ int, reason EvictReason) {
+						evicted = append(evicted, reason)
+					}),
+				)
+				c.Set("a", 1, time.Minute)
+				c.Set("b", 2, time.Minute)
+
+				updated := c.UpdateValue("a", func(int) int {
+					return 100
+				})
+				v, _, ok := c.Peek("a")
+				switch o {
+				case OversizeKeep:
+					require.True(t, updated)
+					require.True(t, ok)
+					require.Equal(t, 100, v)
+					require.Equal(t, 1, c.Len())
+					require.Equal(t, 100, c.Cost())
+					require.Equal(t, []EvictReason{ReasonCostOverage}, evicted)
+				case OversizeReject:
+					require.False(t, updated)
+					require.True(t, ok)
+					require.Equal(t, 1, v)
+					require.Equal(t, 3, c.Cost())
+					require.Equal(t, uint64(1), c.Stats().Rejections)
+					require.Empty(t, evicted)
+				case OversizeEvict:
+					require.False(t, updated)
+					require.False(t, ok)
+					require.Equal(t, 1, c.Len())
+					require.Equal(t, 2, c.Cost())
+					require.Equal(t, []EvictReason{ReasonCostOverage}, evicted)
+				}
+			})
+		}
+	})
+
+	t.Run("NextExpiry", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		_, ok := c.NextExpiry()
+		require.False(t, ok)
+
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Minute)
+		c.Set("c", 3, time.Second*90)
+		next, ok := c.NextExpiry()
+		require.True(t, ok)
+		require.Equal(t, clock.Now().Add(time.Minute), next)
+
+		c.Delete("b")
+		next, _ = c.NextExpiry()
+		require.Equal(t, clock.Now().Add(time.Second*90), next)
+	})
+
+	t.Run("StaleExpiry", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		start := clock.Now()
+		_, err := c.DoStale("a", func() (int, error) {
+			return 1, nil
+		}, time.Second, time.Minute)
 		require.NoError(t, err)
+		c.Set("b", 2, time.Hour)
 
-		// No recompute, cache hit.
-		require.Equal(t, 11, v)
+		// An entry being served stale counts as expired.
+		clock.Advance(2 * time.Second)
+		require.Equal(t, 1, c.ExpiredCount())
+		next, ok := c.NextExpiry()
+		require.True(t, ok)
+		require.Equal(t, start.Add(time.Second), next)
 	})
-}
 
-func TestTLRU_Expires(t *testing.T) {
-	t.Parallel()
-	t.Run("ImmediateExpirey", func(t *testing.T) {
-		t.Parallel()
+	t.Run("Contains", func(t *testing.T) {
 		c := New[string](ConstantCost[int], 10)
-		// This entry should immediately expire.
-		c.Set("a", 10, 0)
-		_, _, ok := c.Get("a")
+		require.False(t, c.Contains("a"))
+		c.Set("a", 1, time.Second)
+		require.True(t, c.Contains("a"))
+		c.Set("b", 2, 0)
+		require.False(t, c.Contains("b"))
+		// The expired entry is left in place.
+		require.Len(t, c.index, 2)
+	})
+
+	t.Run("RecomputeCost", func(t *testing.T) {
+		weight := 1
+		c := New[string](func(int) int {
+			return weight
+		}, 10)
+		for i := 0; i < 5; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		require.Equal(t, 5, c.Cost())
+
+		weight = 3
+		require.Equal(t, 9, c.RecomputeCost())
+		require.Equal(t, []string{"2", "3", "4"}, c.Keys())
+	})
+
+	t.Run("CostOf", func(t *testing.T) {
+		c := New[string](func(v string) int {
+			return len(v)
+		}, 10)
+		c.Set("a", "xxx", time.Minute)
+		c.Set("expired", "x", 0)
+
+		cost, ok := c.CostOf("a")
+		require.True(t, ok)
+		require.Equal(t, 3, cost)
+		_, ok = c.CostOf("expired")
+		require.False(t, ok)
+		_, ok = c.CostOf("missing")
 		require.False(t, ok)
 	})
-	t.Run("NeverExpires", func(t *testing.T) {
-		t.Parallel()
+
+	t.Run("StoredCost", func(t *testing.T) {
+		// A Coster that never returns the same cost twice.
+		var n int
+		c := New[string](func(int) int {
+			n++
+			return n
+		}, -1)
+		for i := 0; i < 10; i++ {
+			c.Set(strconv.Itoa(i), i, time.Minute)
+		}
+		require.Equal(t, 55, c.Cost())
+		cost, ok := c.CostOf("3")
+		require.True(t, ok)
+		require.Equal(t, 4, cost)
+
+		for i := 0; i < 10; i++ {
+			c.Delete(strconv.Itoa(i))
+		}
+		require.Equal(t, 0, c.Cost())
+	})
+
+	t.Run("SetCoster", func(t *testing.T) {
+		c := New[string, string](nil, 10)
+		c.Set("a", "aaaa", time.Second)
+		c.Set("b", "bbbb", time.Second)
+		c.Set("c", "cccc", time.Second)
+		require.Equal(t, 3, c.Cost())
+
+		c.SetCoster(func(v string) int {
+			return len(v)
+		})
+		require.Equal(t, 8, c.Cost())
+		require.Equal(t, []string{"b", "c"}, c.Keys())
+
+		c.SetCoster(nil)
+		require.Equal(t, 2, c.Cost())
+	})
+
+	t.Run("Clear", func(t *testing.T) {
 		c := New[string](ConstantCost[int], 10)
-		c.Set("a", 10, time.Hour*999)
-		time.Sleep(time.Second)
-		_, _, ok := c.Get("a")
+		for i := 0; i < 5; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		c.Clear()
+		require.Equal(t, 0, c.Len())
+		require.Equal(t, 0, c.Cost())
+		require.Equal(t, 0, c.ttlHeap.Len())
+		_, _, ok := c.Get("1")
+		require.False(t, ok)
+
+		// The cache is still usable after a Clear.
+		c.Set("a", 1, time.Second)
+		require.Equal(t, 1, c.Len())
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		require.Empty(t, c.Keys())
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		c.Set("c", 3, time.Second)
+		c.Set("expired", 4, 0)
+		c.Get("a")
+		require.Equal(t, []string{"b", "c", "a"}, c.Keys())
+	})
+
+	t.Run("Items", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Hour)
+		c.Set("expired", 3, 0)
+		c.Get("a")
+		require.Equal(t, []Entry[string, int]{
+			{Key: "b", Value: 2, TTL: time.Hour, Deadline: clock.Now().Add(time.Hour)},
+			{Key: "a", Value: 1, TTL: time.Minute, Deadline: clock.Now().Add(time.Minute)},
+		}, c.Items())
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		c.Set("c", 3, time.Second)
+		c.Set("expired", 4, 0)
+
+		var sum int
+		c.Range(func(key string, v int, deadline time.Time) bool {
+			require.NotEqual(t, "expired", key)
+			sum += v
+			return true
+		})
+		require.Equal(t, 6, sum)
+
+		var visited int
+		c.Range(func(string, int, time.Time) bool {
+			visited++
+			return false
+		})
+		require.Equal(t, 1, visited)
+	})
+
+	t.Run("RangeByExpiry", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], -1, WithClock[string, int](clock))
+		c.Set("c", 3, time.Minute*3)
+		c.Set("a", 1, time.Minute)
+		c.Set("d", 4, time.Minute*4)
+		c.Set("b", 2, time.Minute*2)
+		c.Set("expired", 0, 0)
+
+		var keys []string
+		var last time.Time
+		c.RangeByExpiry(func(key string, v int, deadline time.Time) bool {
+			require.False(t, deadline.Before(last))
+			last = deadline
+			keys = append(keys, key)
+			return len(keys) < 3
+		})
+		require.Equal(t, []string{"a", "b", "c"}, keys)
+	})
+
+	t.Run("FindKeys", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		for i := 0; i < 6; i++ {
+			c.Set(strconv.Itoa(i), i, time.Minute)
+		}
+		c.Set("expired", 8, 0)
+
+		even := func(v int) bool {
+			return v%2 == 0
+		}
+		require.Equal(t, []string{"0", "2", "4"}, c.FindKeys(even))
+		require.Empty(t, c.FindKeys(func(v int) bool {
+			return v > 10
+		}))
+	})
+
+	t.Run("GetMany", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 3)
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		c.Set("c", 3, 0)
+		require.Equal(t, map[string]int{"a": 1, "b": 2}, c.GetMany([]string{"a", "b", "c", "d"}))
+
+		// Hits are bumped.
+		c.Set("d", 4, time.Second)
+		c.GetMany([]string{"a"})
+		c.Set("e", 5, time.Second)
+		require.Equal(t, []string{"d", "a", "e"}, c.Keys())
+	})
+
+	t.Run("SetDelta", func(t *testing.T) {
+		c := New[string](func(v string) int {
+			return len(v)
+		}, 10)
+
+		var total int
+		total += c.SetDelta("a", "xxxx", time.Minute)
+		require.Equal(t, 4, total)
+		// Replacing counts the difference.
+		total += c.SetDelta("a", "xx", time.Minute)
+		require.Equal(t, 2, total)
+		total += c.SetDelta("b", "xxxxxx", time.Minute)
+		require.Equal(t, 8, total)
+		// Evictions count against the new value.
+		require.Equal(t, -3, c.SetDelta("c", "xxxxx", time.Minute))
+		total -= 3
+		require.Equal(t, c.Cost(), total)
+	})
+
+	t.Run("SetR", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 2, WithClock[string, int](clock))
+		require.Empty(t, c.SetR("a", 1, time.Second))
+		require.Empty(t, c.SetR("b", 2, time.Hour))
+		require.Empty(t, c.SetR("b", 3, time.Hour))
+		clock.Advance(time.Minute)
+		require.Equal(t, []Entry[string, int]{
+			{Key: "a", Value: 1, Deadline: clock.Now().Add(time.Second - time.Minute)},
+		}, c.SetR("c", 4, time.Hour))
+
+		evicted := c.SetR("d", 5, time.Hour)
+		require.Equal(t, []Entry[string, int]{
+			{Key: "b", Value: 3, Deadline: clock.Now().Add(time.Hour - time.Minute)},
+		}, evicted)
+	})
+
+	t.Run("SetMany", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 3)
+		c.Set("old", 0, time.Second)
+		var entries []Entry[string, int]
+		for i := 0; i < 5; i++ {
+			entries = append(entries, Entry[string, int]{Key: strconv.Itoa(i), Value: i, TTL: time.Second})
+		}
+		c.SetMany(entries)
+		require.Equal(t, []string{"2", "3", "4"}, c.Keys())
+		require.Equal(t, 3, c.Cost())
+	})
+
+	t.Run("GetOrSet", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		v, loaded, stored := c.GetOrSet("a", 1, time.Second)
+		require.False(t, loaded)
+		require.True(t, stored)
+		require.Equal(t, 1, v)
+
+		v, loaded, stored = c.GetOrSet("a", 2, time.Second)
+		require.True(t, loaded)
+		require.False(t, stored)
+		require.Equal(t, 1, v)
+	})
+
+	t.Run("OversizeConditionalSet", func(t *testing.T) {
+		for name, o := range map[string]Oversize{
+			"Keep":   OversizeKeep,
+			"Reject": OversizeReject,
+			"Evict":  OversizeEvict,
+		} {
+			o := o
+			t.Run(name, func(t *testing.T) {
+				c := New(
+					func(v int) int {
+						return v
+					},
+					10,
+					WithOversize[string, int](o),
+				)
+				kept := o == OversizeKeep
+
+				require.Equal(t, kept, c.SetIfAbsent("tok", 100, time.Minute))
+				require.False(t, c.SetIfAbsent("tok", 100, time.Minute))
+				require.Equal(t, kept, c.Contains("tok"))
+				c.Delete("tok")
+
+				_, set := c.SetNX("lock", 100, time.Minute)
+				require.Equal(t, kept, set)
+				require.Equal(t, kept, c.Contains("lock"))
+				c.Delete("lock")
+
+				_, loaded, stored := c.GetOrSet("a", 100, time.Minute)
+				require.False(t, loaded)
+				require.Equal(t, kept, stored)
+				require.Equal(t, kept, c.Contains("a"))
+			})
+		}
+	})
+
+	t.Run("SetIfAbsent", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 2)
+		require.True(t, c.SetIfAbsent("a", 1, time.Second))
+		c.Set("b", 2, time.Second)
+		require.False(t, c.SetIfAbsent("a", 3, time.Hour))
+
+		v, deadline, ok := c.Peek("a")
 		require.True(t, ok)
+		require.Equal(t, 1, v)
+		require.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Millisecond*100)
+
+		// "a" was not bumped, so it is evicted first.
+		c.Set("c", 3, time.Second)
+		require.False(t, c.Contains("a"))
+
+		// Expired entries count as absent.
+		c.Set("d", 4, 0)
+		require.True(t, c.SetIfAbsent("d", 5, time.Second))
 	})
-}
 
-func Benchmark_TLRU_Get(b *testing.B) {
-	c := New[string](ConstantCost[int], 1000)
-	c.Set("test-key", 10, time.Second)
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		c.Get("test-key")
-	}
-}
+	t.Run("SetNX", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
 
-func Benchmark_TLRU_Set(b *testing.B) {
-	c := New[string](ConstantCost[int], 1000)
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		c.Set("test-key-"+strconv.Itoa(i), 10, time.Second)
-	}
+		_, set := c.SetNX("lock", 1, time.Minute)
+		require.True(t, set)
+		held, set := c.SetNX("lock", 2, time.Hour)
+		require.False(t, set)
+		require.Equal(t, clock.Now().Add(time.Minute), held)
+		v, _, _ := c.Peek("lock")
+		require.Equal(t, 1, v)
+
+		// Once the lease expires, the key can be taken.
+		clock.Advance(time.Minute)
+		_, set = c.SetNX("lock", 2, time.Hour)
+		require.True(t, set)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		_, ok := c.TTL("a")
+		require.False(t, ok)
+
+		c.Set("a", 1, time.Minute)
+		ttl, ok := c.TTL("a")
+		require.True(t, ok)
+		require.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+		c.Set("b", 2, 0)
+		_, ok = c.TTL("b")
+		require.False(t, ok)
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 2)
+		require.False(t, c.Touch("a", time.Second))
+
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		require.True(t, c.Touch("a", time.Hour))
+		ttl, ok := c.TTL("a")
+		require.True(t, ok)
+		require.Greater(t, ttl, time.Minute)
+		require.Equal(t, 2, c.ttlHeap.Len())
+
+		// Touch does not bump the entry.
+		c.Set("c", 3, time.Second)
+		require.False(t, c.Contains("a"))
+		require.Equal(t, 2, c.ttlHeap.Len())
+	})
+
+	t.Run("RefreshOnGet", func(t *testing.T) {
+		c := New(ConstantCost[int], 10, WithRefreshOnGet[string, int](time.Hour))
+		c.Set("a", 1, time.Second)
+		_, deadline, ok := c.Get("a")
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Second)
+
+		// Peek does not refresh.
+		c.Set("b", 2, time.Second)
+		_, deadline, ok = c.Peek("b")
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Millisecond*100)
+
+		// Repeated gets must keep the heap consistent.
+		for i := 0; i < 100; i++ {
+			c.Get("a")
+			c.Get("b")
+		}
+		require.Equal(t, 2, c.ttlHeap.Len())
+		c.Delete("a")
+		c.Delete("b")
+		require.Equal(t, 0, c.ttlHeap.Len())
+	})
+
+	t.Run("SetWithDeadline", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		want := time.Now().Add(time.Hour).Truncate(time.Second)
+		c.SetWithDeadline("a", 1, want)
+		_, deadline, ok := c.Get("a")
+		require.True(t, ok)
+		require.True(t, want.Equal(deadline))
+
+		c.SetWithDeadline("b", 2, time.Now().Add(-time.Second))
+		_, _, ok = c.Get("b")
+		require.False(t, ok)
+	})
+
+	t.Run("DefaultTTL", func(t *testing.T) {
+		c := New(ConstantCost[int], 10, WithDefaultTTL[string, int](time.Hour))
+		c.SetDefault("a", 1)
+		c.Set("b", 2, DefaultTTL)
+		c.Set("c", 3, time.Second)
+		for _, key := range []string{"a", "b"} {
+			_, deadline, ok := c.Get(key)
+			require.True(t, ok)
+			require.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Second)
+		}
+		_, deadline, ok := c.Get("c")
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Millisecond*100)
+	})
+
+	t.Run("OnEvict", func(t *testing.T) {
+		evicted := make(map[string]EvictReason)
+		c := New(ConstantCost[int], 10, WithOnEvict(func(key string, _ int, reason EvictReason) {
+			evicted[key] = reason
+		}))
+		c.Set("a", 1, time.Second)
+		c.Set("a", 2, time.Second)
+		require.Equal(t, ReasonReplaced, evicted["a"])
+
+		c.Delete("a")
+		require.Equal(t, ReasonManual, evicted["a"])
+
+		c.Set("b", 1, time.Second)
+		c.Clear()
+		require.Equal(t, ReasonManual, evicted["b"])
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 1)
+		events := c.Events()
+		require.Equal(t, events, c.Events())
+
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Second)
+		c.Delete("b")
+		require.Equal(t, EvictEvent[string, int]{Key: "a", Value: 1, Reason: ReasonCostOverage}, <-events)
+		require.Equal(t, EvictEvent[string, int]{Key: "b", Value: 2, Reason: ReasonManual}, <-events)
+
+		// A full buffer drops events rather than block.
+		for i := 0; i < eventBuffer+10; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		require.Len(t, events, eventBuffer)
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 3, WithClock[string, int](clock))
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Hour)
+
+		clone := c.Clone()
+		require.Equal(t, c.Items(), clone.Items())
+		require.Equal(t, 3, clone.Cost())
+
+		// The caches are independent.
+		clone.Set("d", 4, time.Hour)
+		clone.Delete("b")
+		require.Equal(t, []string{"a", "b", "c"}, c.Keys())
+		require.Equal(t, []string{"c", "d"}, clone.Keys())
+
+		clock.Advance(time.Minute * 2)
+		require.Equal(t, 1, c.Evict())
+		require.Equal(t, 0, clone.Evict())
+		require.Equal(t, 2, clone.Len())
+	})
+
+	t.Run("EvictReasons", func(t *testing.T) {
+		clock := newFakeClock()
+		evicted := make(map[string]EvictReason)
+		c := New(ConstantCost[int], 2,
+			WithClock[string, int](clock),
+			WithOnEvict(func(key string, _ int, reason EvictReason) {
+				evicted[key] = reason
+			}),
+		)
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Hour)
+		clock.Advance(time.Minute)
+
+		// "a" is reclaimed because it expired, not because of cost.
+		c.Set("c", 3, time.Hour)
+		require.Equal(t, ReasonExpired, evicted["a"])
+
+		// "b" is still fresh but must make room.
+		c.Set("d", 4, time.Hour)
+		require.Equal(t, ReasonCostOverage, evicted["b"])
+
+		// Overwriting an expired entry reports expiry.
+		c.Set("e", 5, 0)
+		c.Set("e", 6, time.Hour)
+		require.Equal(t, ReasonExpired, evicted["e"])
+
+		// Lazily expired on Get.
+		c.Set("f", 7, time.Second)
+		clock.Advance(time.Minute)
+		c.Get("f")
+		require.Equal(t, ReasonExpired, evicted["f"])
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 2, WithClock[string, int](clock))
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Hour)
+		c.Get("a")
+		c.Get("a")
+		c.Get("missing")
+		clock.Advance(time.Minute)
+		c.Set("c", 3, time.Hour)
+		c.Set("d", 4, time.Hour)
+		_, err := c.Do("e", func() (int, error) { return 5, nil }, time.Hour)
+		require.NoError(t, err)
+
+		require.Equal(t, Stats{
+			Hits:          2,
+			Misses:        2,
+			Computed:      1,
+			Insertions:    5,
+			Expirations:   1,
+			CostEvictions: 2,
+		}, c.Stats())
+		require.Equal(t, 0.5, c.Stats().HitRatio())
+
+		c.ResetStats()
+		require.Equal(t, Stats{}, c.Stats())
+		require.Equal(t, 2, c.Len())
+		c.Get("e")
+		require.EqualValues(t, 1, c.Stats().Hits)
+	})
+
+	t.Run("EvictExpired", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 1, time.Second)
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Hour)
+		// Simulate a deliberate over-limit state.
+		c.costLimit = 1
+
+		clock.Advance(time.Minute)
+		require.Equal(t, 1, c.EvictExpired())
+		require.Equal(t, []string{"b", "c"}, c.Keys())
+		require.Equal(t, 1, c.Evict())
+		require.Equal(t, []string{"c"}, c.Keys())
+	})
+
+	t.Run("MinTTL", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], -1,
+			WithClock[string, int](clock),
+			WithMinTTL[string, int](time.Second),
+		)
+		c.Set("tiny", 1, time.Nanosecond)
+		c.Set("long", 2, time.Minute)
+		c.Set("zero", 3, 0)
+
+		ttl, ok := c.TTL("tiny")
+		require.True(t, ok)
+		require.Equal(t, time.Second, ttl)
+		ttl, _ = c.TTL("long")
+		require.Equal(t, time.Minute, ttl)
+		require.False(t, c.Contains("zero"))
+	})
+
+	t.Run("ZeroTTLNoExpiry", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 2,
+			WithClock[string, int](clock),
+			WithZeroTTLMeansNoExpiry[string, int](),
+		)
+		c.Set("forever", 1, 0)
+		c.Set("brief", 2, time.Second)
+
+		clock.Advance(time.Hour)
+		require.Equal(t, 1, c.Evict())
+		v, deadline, ok := c.Get("forever")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		require.True(t, deadline.IsZero())
+		ttl, ok := c.TTL("forever")
+		require.True(t, ok)
+		require.Zero(t, ttl)
+
+		// Extending leaves the entry permanent.
+		_, deadline, ok = c.GetExtend("forever", time.Minute)
+		require.True(t, ok)
+		require.True(t, deadline.IsZero())
+
+		// Never expiring doesn't exempt the entry from cost eviction.
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Hour)
+		require.False(t, c.Contains("forever"))
+		require.Equal(t, 2, c.Len())
+
+		// Loaders follow the option too, with NoCache to skip caching.
+		c = New(ConstantCost[int], -1,
+			WithClock[string, int](clock),
+			WithZeroTTLMeansNoExpiry[string, int](),
+		)
+		one := func() (int, error) {
+			return 1, nil
+		}
+		_, err := c.Do("do", one, 0)
+		require.NoError(t, err)
+		_, err = c.Do("nocache", one, NoCache)
+		require.NoError(t, err)
+		_, err = c.DoIf("doif", func() (int, bool, error) {
+			return 1, false, nil
+		}, 0)
+		require.NoError(t, err)
+		clock.Advance(time.Hour)
+		require.Equal(t, []string{"do"}, c.Keys())
+
+		// Without the option, a zero deadline still expires immediately.
+		c = New(ConstantCost[int], -1, WithClock[string, int](clock))
+		c.SetWithDeadline("zero", 1, time.Time{})
+		require.False(t, c.Contains("zero"))
+	})
+
+	t.Run("SetPermanent", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 2,
+			WithClock[string, int](clock),
+			WithRefreshOnGet[string, int](time.Minute),
+		)
+		c.SetPermanent("ref", 1)
+		c.Set("a", 2, time.Second)
+
+		clock.Advance(24 * time.Hour)
+		require.Equal(t, 1, c.Evict())
+		// Refreshing on Get doesn't give the entry a deadline.
+		_, deadline, ok := c.Get("ref")
+		require.True(t, ok)
+		require.True(t, deadline.IsZero())
+		clock.Advance(24 * time.Hour)
+		require.True(t, c.Contains("ref"))
+
+		// Overwriting with a TTL makes the entry expire again.
+		c.Set("ref", 3, time.Second)
+		clock.Advance(time.Minute)
+		require.False(t, c.Contains("ref"))
+
+		c.SetPermanent("ref", 1)
+		c.Set("b", 2, time.Hour)
+		c.Set("c", 3, time.Hour)
+		require.False(t, c.Contains("ref"))
+	})
+
+	t.Run("AnchoredTTL", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10,
+			WithClock[string, int](clock),
+			WithAnchoredTTL[string, int](),
+		)
+		c.Set("token", 1, time.Minute)
+		c.Set("other", 0, time.Hour)
+		clock.Advance(30 * time.Second)
+		c.Set("token", 2, time.Hour)
+
+		v, deadline, ok := c.Get("token")
+		require.True(t, ok)
+		require.Equal(t, 2, v)
+		require.True(t, deadline.Equal(clock.Now().Add(30*time.Second)))
+		require.Equal(t, []string{"other", "token"}, c.Keys())
+
+		clock.Advance(time.Minute)
+		require.False(t, c.Contains("token"))
+		// An expired entry starts over.
+		c.Set("token", 3, time.Hour)
+		ttl, _ := c.TTL("token")
+		require.Equal(t, time.Hour, ttl)
+	})
+
+	t.Run("OverLimit", func(t *testing.T) {
+		c := New[string](func(v int) int {
+			return v
+		}, 10)
+		c.Set("a", 4, time.Minute)
+		c.Set("b", 4, time.Minute)
+		require.Zero(t, c.Stats().OverLimit)
+
+		// An oversized value evicts everything else and is kept.
+		c.Set("huge", 11, time.Minute)
+		require.Equal(t, []string{"huge"}, c.Keys())
+		require.Equal(t, 11, c.Cost())
+		require.EqualValues(t, 1, c.Stats().OverLimit)
+
+		// The next insertion brings the cache back within its limit.
+		c.Set("c", 4, time.Minute)
+		require.Equal(t, []string{"c"}, c.Keys())
+		require.EqualValues(t, 1, c.Stats().OverLimit)
+	})
+
+	t.Run("Oversize", func(t *testing.T) {
+		newCache := func(o Oversize, reasons *[]EvictReason) *Cache[string, int] {
+			c := New(
+				func(v int) int {
+					return v
+				},
+				10,
+				WithOversize[string, int](o),
+				WithOnEvict(func(_ string, _ int, reason EvictReason) {
+					*reasons = append(*reasons, reason)
+				}),
+			)
+			c.Set("a", 4, time.Minute)
+			c.Set("b", 4, time.Minute)
+			return c
+		}
+
+		var reasons []EvictReason
+		c := newCache(OversizeKeep, &reasons)
+		c.Set("huge", 11, time.Minute)
+		require.Equal(t, []string{"huge"}, c.Keys())
+		require.Equal(t, []EvictReason{ReasonCostOverage, ReasonCostOverage}, reasons)
+
+		reasons = nil
+		c = newCache(OversizeReject, &reasons)
+		c.Set("huge", 11, time.Minute)
+		require.Equal(t, []string{"a", "b"}, c.Keys())
+		require.Equal(t, 8, c.Cost())
+		require.EqualValues(t, 1, c.Stats().Rejections)
+		require.Empty(t, reasons)
+		// Overwriting with an oversized value still removes the old one.
+		c.Set("a", 11, time.Minute)
+		require.Equal(t, []string{"b"}, c.Keys())
+		require.Equal(t, []EvictReason{ReasonReplaced}, reasons)
+
+		reasons = nil
+		c = newCache(OversizeEvict, &reasons)
+		evicted := c.SetR("huge", 11, time.Minute)
+		require.Equal(t, []string{"a", "b"}, c.Keys())
+		require.Equal(t, 8, c.Cost())
+		require.Equal(t, []EvictReason{ReasonCostOverage}, reasons)
+		require.Len(t, evicted, 1)
+		require.Equal(t, "huge", evicted[0].Key)
+		require.Zero(t, c.Stats().OverLimit)
+	})
+
+	t.Run("SetAll", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("old", 0, time.Hour)
+		c.SetAll(map[string]int{"a": 1, "b": 2, "c": 3}, time.Minute)
+		require.Equal(t, 4, c.Len())
+		for _, key := range []string{"a", "b", "c"} {
+			ttl, ok := c.TTL(key)
+			require.True(t, ok)
+			require.Equal(t, time.Minute, ttl)
+		}
+
+		// An oversized batch is trimmed to the limit once it's inserted,
+		// oldest entries first.
+		batch := make(map[string]int)
+		for i := 0; i < 20; i++ {
+			batch[strconv.Itoa(i)] = i
+		}
+		c.SetAll(batch, time.Minute)
+		require.Equal(t, 10, c.Len())
+		require.False(t, c.Contains("old"))
+		require.False(t, c.deferEviction)
+	})
+
+	t.Run("GetStale", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 1, time.Minute)
+
+		v, _, expired, ok := c.GetStale("a")
+		require.True(t, ok)
+		require.False(t, expired)
+		require.Equal(t, 1, v)
+
+		clock.Advance(time.Hour)
+		v, deadline, expired, ok := c.GetStale("a")
+		require.True(t, ok)
+		require.True(t, expired)
+		require.Equal(t, 1, v)
+		require.True(t, deadline.Equal(clock.Now().Add(-59*time.Minute)))
+		// The stale entry is left in place.
+		_, _, expired, ok = c.GetStale("a")
+		require.True(t, ok)
+		require.True(t, expired)
+		_, _, ok = c.Get("a")
+		require.False(t, ok)
+
+		_, _, _, ok = c.GetStale("a")
+		require.False(t, ok)
+	})
+
+	t.Run("MaxAge", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10,
+			WithClock[string, int](clock),
+			WithRefreshOnGet[string, int](time.Minute),
+			WithMaxAge[string, int](5*time.Minute),
+		)
+		start := clock.Now()
+		c.Set("hot", 1, time.Minute)
+		c.SetPermanent("ref", 2)
+		c.Set("short", 3, time.Second)
+
+		// Sliding expiration keeps the entry alive up to MaxAge.
+		for i := 0; i < 4; i++ {
+			clock.Advance(50 * time.Second)
+			_, _, ok := c.Get("hot")
+			require.True(t, ok)
+		}
+		_, deadline, ok := c.GetExtend("hot", time.Hour)
+		require.True(t, ok)
+		require.True(t, deadline.Equal(start.Add(5*time.Minute)))
+		_, deadline, _ = c.Peek("ref")
+		require.True(t, deadline.Equal(start.Add(5*time.Minute)))
+		require.False(t, c.Contains("short"))
+
+		clock.Advance(2 * time.Minute)
+		_, _, ok = c.Get("hot")
+		require.False(t, ok)
+		require.False(t, c.Contains("ref"))
+
+		// Setting again starts a new lifetime.
+		c.Set("hot", 1, time.Hour)
+		ttl, _ := c.TTL("hot")
+		require.Equal(t, 5*time.Minute, ttl)
+	})
+
+	t.Run("MaxAgeStale", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(nil, -1,
+			WithClock[string, int](clock),
+			WithMaxAge[string, int](5*time.Minute),
+		)
+		var calls int
+		fn := func() (int, error) {
+			calls++
+			return calls, nil
+		}
+
+		v, err := c.DoStale("a", fn, time.Hour, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+		_, err = c.DoStale("b", fn, 4*time.Minute, time.Hour)
+		require.NoError(t, err)
+		ttl, _ := c.TTL("b")
+		require.Equal(t, 4*time.Minute, ttl)
+
+		// The grace period doesn't outlast MaxAge.
+		clock.Advance(5*time.Minute + time.Second)
+		require.Equal(t, 0, c.Len())
+		_, ok := c.stale("b")
+		require.False(t, ok)
+		v, err = c.DoStale("a", fn, time.Hour, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 3, v)
+	})
+
+	t.Run("KeyCost", func(t *testing.T) {
+		c := New(ConstantCost[string], 10,
+			WithKeyCost(func(k, v string) int {
+				return len(k) + len(v)
+			}),
+		)
+		c.Set("abc", "de", time.Minute)
+		require.Equal(t, 5, c.Cost())
+		c.Set("fghij", "", time.Minute)
+		require.Equal(t, 10, c.Cost())
+		c.Set("k", "", time.Minute)
+		require.Equal(t, []string{"fghij", "k"}, c.Keys())
+
+		// SetCoster reverts to value-only costs.
+		c.SetCoster(nil)
+		require.Equal(t, 2, c.Cost())
+	})
+
+	t.Run("CostTTL", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(
+			func(v string) int {
+				return len(v)
+			},
+			-1,
+			WithClock[string, string](clock),
+			WithCostTTL[string, string](func(cost int, ttl time.Duration) time.Duration {
+				if cost > 3 {
+					return ttl / 2
+				}
+				return ttl
+			}),
+		)
+		c.Set("small", "x", time.Minute)
+		c.Set("large", "xxxx", time.Minute)
+
+		ttl, _ := c.TTL("small")
+		require.Equal(t, time.Minute, ttl)
+		ttl, _ = c.TTL("large")
+		require.Equal(t, time.Second*30, ttl)
+	})
+
+	t.Run("EvictMany", func(t *testing.T) {
+		var evicted []string
+		clock := newFakeClock()
+		c := New(
+			func(v int) int {
+				return v
+			},
+			100,
+			WithClock[string, int](clock),
+			WithOnEvict(func(key string, _ int, reason EvictReason) {
+				if reason == ReasonCostOverage {
+					evicted = append(evicted, key)
+				}
+			}),
+		)
+		for i := 0; i < 100; i++ {
+			c.Set(strconv.Itoa(i), 1, time.Hour+time.Duration(i%7)*time.Second)
+		}
+		// One large write evicts most of the cache in a batch.
+		c.Set("large", 90, time.Hour)
+		require.Len(t, evicted, 90)
+		for i, key := range evicted {
+			require.Equal(t, strconv.Itoa(i), key)
+		}
+		require.Equal(t, 100, c.Cost())
+		require.Equal(t, 11, c.ttlHeap.Len())
+		require.Equal(t, 11, c.Len())
+
+		// The ttlHeap is still ordered.
+		clock.Advance(time.Hour + time.Second*3)
+		require.Equal(t, 96, c.EvictExpired())
+		require.Equal(t, []string{"90", "95", "96", "97"}, c.Keys())
+	})
+
+	t.Run("Corruption", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		c.Set("a", 1, time.Minute)
+		c.ttlHeap.Remove(c.index["a"].Data.expiry)
+		require.Panics(t, func() {
+			c.Delete("a")
+		})
+
+		var errs []error
+		clock := newFakeClock()
+		c = New(ConstantCost[int], 10,
+			WithClock[string, int](clock),
+			WithCorruptionHandler[string, int](func(err error) {
+				errs = append(errs, err)
+			}),
+		)
+		c.Set("a", 1, time.Minute)
+		c.Set("b", 2, time.Minute)
+		c.ttlHeap.Remove(c.index["a"].Data.expiry)
+		require.Equal(t, 1, c.Delete("a"))
+		require.Len(t, errs, 1)
+		require.ErrorIs(t, errs[0], ErrCorrupt)
+
+		// An orphaned deadline is dropped rather than looped on.
+		c.ttlHeap.Push(expiry[string]{deadline: clock.Now(), key: "orphan"})
+		clock.Advance(time.Second)
+		require.Equal(t, 0, c.Evict())
+		require.Len(t, errs, 2)
+		require.Equal(t, []string{"b"}, c.Keys())
+		require.Equal(t, 1, c.Cost())
+	})
+
+	t.Run("Resize", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+		for i := 0; i < 10; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		require.Equal(t, 6, c.Resize(4))
+		require.Equal(t, 4, c.CostLimit())
+		require.Equal(t, []string{"6", "7", "8", "9"}, c.Keys())
+
+		require.Equal(t, 0, c.Resize(-1))
+		for i := 0; i < 100; i++ {
+			c.Set(strconv.Itoa(i), i, time.Second)
+		}
+		require.Equal(t, 100, c.Len())
+	})
+
+	t.Run("ResizeEvictsExpiredFirst", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 1, time.Hour)
+		c.Set("b", 2, time.Second)
+		c.Set("c", 3, time.Hour)
+
+		// "a" is least recently used, but "b" has expired.
+		clock.Advance(time.Minute)
+		require.Equal(t, 1, c.Resize(2))
+		require.Equal(t, []string{"a", "c"}, c.Keys())
+		require.EqualValues(t, 1, c.Stats().Expirations)
+		require.EqualValues(t, 0, c.Stats().CostEvictions)
+	})
+
+	t.Run("ZeroCost", func(t *testing.T) {
+		c := New[string](func(v int) int {
+			return v
+		}, 3)
+		for i := -5; i <= 0; i++ {
+			c.Set(strconv.Itoa(i), i, time.Minute)
+		}
+		// Non-positive costs are clamped to 1, so entries stay bounded.
+		require.Equal(t, 3, c.Len())
+		require.Equal(t, 3, c.Cost())
+		require.Equal(t, []string{"-2", "-1", "0"}, c.Keys())
+		require.Equal(t, 1, c.Delete("0"))
+		require.Equal(t, 2, c.RecomputeCost())
+	})
+
+	t.Run("MaxEntries", func(t *testing.T) {
+		c := New(
+			func(v string) int {
+				return len(v)
+			},
+			10,
+			WithMaxEntries[string, string](3),
+		)
+		// Cheap entries are bounded by count.
+		for i := 0; i < 5; i++ {
+			c.Set(strconv.Itoa(i), "x", time.Second)
+		}
+		require.Equal(t, []string{"2", "3", "4"}, c.Keys())
+
+		// Expensive entries are still bounded by cost.
+		c.Set("big", "0123456789", time.Second)
+		require.Equal(t, []string{"big"}, c.Keys())
+	})
+
+	t.Run("Jitter", func(t *testing.T) {
+		clock := newFakeClock()
+		newCache := func() *Cache[int, int] {
+			return New(ConstantCost[int], -1,
+				WithClock[int, int](clock),
+				WithJitter[int, int](0.1, rand.New(rand.NewSource(1))),
+			)
+		}
+		c := newCache()
+		deadlines := make(map[time.Time]struct{})
+		for i := 0; i < 100; i++ {
+			c.Set(i, i, time.Minute)
+			_, deadline, ok := c.Peek(i)
+			require.True(t, ok)
+			ttl := deadline.Sub(clock.Now())
+			require.GreaterOrEqual(t, ttl, time.Second*54)
+			require.Less(t, ttl, time.Second*66)
+			deadlines[deadline] = struct{}{}
+		}
+		require.Greater(t, len(deadlines), 90)
+
+		// The same seed yields the same deadlines.
+		c2 := newCache()
+		for i := 0; i < 100; i++ {
+			c2.Set(i, i, time.Minute)
+		}
+		require.Equal(t, c.Items(), c2.Items())
+
+		// Long TTLs don't overflow into the past.
+		for i := 0; i < 100; i++ {
+			c.Set(i, i, math.MaxInt64)
+		}
+		require.Equal(t, 100, c.Len())
+
+		require.Panics(t, func() {
+			WithJitter[int, int](1.5, nil)
+		})
+		require.Panics(t, func() {
+			WithJitter[int, int](-0.1, nil)
+		})
+	})
+
+	t.Run("Do", func(t *testing.T) {
+		c := New[string, int](nil, -1)
+
+		n := 10
+		fn := func() (int, error) {
+			n += 1
+			return n, nil
+		}
+
+		v, err := c.Do("a", fn, time.Second)
+		require.NoError(t, err)
+
+		require.Equal(t, 11, v)
+
+		v, err = c.Do("a", fn, time.Second)
+		require.NoError(t, err)
+
+		// No recompute, cache hit.
+		require.Equal(t, 11, v)
+	})
+
+	t.Run("DoContext", func(t *testing.T) {
+		c := New[string, int](nil, -1)
+
+		v, err := c.DoContext(context.Background(), "a", func(ctx context.Context) (int, error) {
+			return 1, nil
+		}, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+
+		// A cancelled caller returns promptly while the shared computation
+		// completes and is cached.
+		ctx, cancel := context.WithCancel(context.Background())
+		release := make(chan struct{})
+		callerErr := make(chan error, 1)
+		fnCtxErr := make(chan error, 1)
+		go func() {
+			_, err := c.DoContext(ctx, "b", func(ctx context.Context) (int, error) {
+				<-release
+				fnCtxErr <- ctx.Err()
+				return 2, nil
+			}, time.Second)
+			callerErr <- err
+		}()
+		cancel()
+		require.ErrorIs(t, <-callerErr, context.Canceled)
+		close(release)
+		// The computation's context is not cancelled.
+		require.NoError(t, <-fnCtxErr)
+
+		require.Eventually(t, func() bool {
+			return c.Contains("b")
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("DoTimeout", func(t *testing.T) {
+		c := New[string, int](nil, -1)
+
+		release := make(chan struct{})
+		_, err := c.DoTimeout("a", func() (int, error) {
+			<-release
+			return 1, nil
+		}, time.Minute, time.Millisecond)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, c.Contains("a"))
+
+		// The abandoned computation still populates the cache.
+		close(release)
+		require.Eventually(t, func() bool {
+			return c.Contains("a")
+		}, time.Second, time.Millisecond)
+
+		v, err := c.DoTimeout("a", func() (int, error) {
+			return 2, nil
+		}, time.Minute, time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+	})
+
+	t.Run("DoWithErrorTTL", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(nil, -1, WithClock[string, int](clock))
+
+		var calls int
+		wantErr := errors.New("not found")
+		fn := func() (int, error) {
+			calls++
+			if calls == 1 {
+				return 0, wantErr
+			}
+			return calls, nil
+		}
+
+		_, err := c.DoWithErrorTTL("a", fn, time.Hour, time.Second)
+		require.ErrorIs(t, err, wantErr)
+		// The error is served from the cache.
+		_, err = c.DoWithErrorTTL("a", fn, time.Hour, time.Second)
+		require.ErrorIs(t, err, wantErr)
+		require.Equal(t, 1, calls)
+
+		clock.Advance(time.Second)
+		v, err := c.DoWithErrorTTL("a", fn, time.Hour, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, 2, v)
+
+		// Writing or deleting the key drops the cached error.
+		fail := func() (int, error) {
+			return 0, wantErr
+		}
+		_, err = c.DoWithErrorTTL("c", fail, time.Hour, time.Hour)
+		require.ErrorIs(t, err, wantErr)
+		c.Set("c", 5, time.Hour)
+		c.Delete("c")
+		v, err = c.DoWithErrorTTL("c", fn, time.Hour, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 3, v)
+
+		_, err = c.DoWithErrorTTL("d", fail, time.Hour, time.Hour)
+		require.ErrorIs(t, err, wantErr)
+		c.Delete("d")
+		v, err = c.DoWithErrorTTL("d", fn, time.Hour, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 4, v)
+
+		// A zero error TTL does not cache errors.
+		calls = 0
+		_, err = c.DoWithErrorTTL("b", fn, time.Hour, 0)
+		require.ErrorIs(t, err, wantErr)
+		v, err = c.DoWithErrorTTL("b", fn, time.Hour, 0)
+		require.NoError(t, err)
+		require.Equal(t, 2, v)
+	})
+
+	t.Run("DoStale", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(nil, -1, WithClock[string, int](clock))
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		fn := func() (int, error) {
+			n := calls.Add(1)
+			if n == 2 {
+				// Hold the background refresh until we've inspected the
+				// cache.
+				<-release
+			}
+			return int(n), nil
+		}
+
+		v, err := c.DoStale("a", fn, time.Minute, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+
+		// Past the TTL, the stale value is served while a refresh runs.
+		clock.Advance(time.Minute * 2)
+		require.False(t, c.Contains("a"))
+		_, _, ok := c.Get("a")
+		require.False(t, ok)
+		v, err = c.DoStale("a", fn, time.Minute, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+		require.Equal(t, 0, c.Len())
+		require.Empty(t, c.Keys())
+		close(release)
+		require.Eventually(t, func() bool {
+			return c.Contains("a")
+		}, time.Second, time.Millisecond)
+		require.Equal(t, 1, c.Len())
+		v, err = c.DoStale("a", fn, time.Minute, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 2, v)
+
+		// Past the grace period, DoStale blocks on a recompute.
+		clock.Advance(time.Hour * 2)
+		require.Equal(t, 1, c.Evict())
+		v, err = c.DoStale("a", fn, time.Minute, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 3, v)
+	})
+
+	t.Run("DoTTL", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(nil, -1, WithClock[string, int](clock))
+
+		var calls int
+		fn := func(ttl time.Duration) func() (int, time.Duration, error) {
+			return func() (int, time.Duration, error) {
+				calls++
+				return calls, ttl, nil
+			}
+		}
+
+		v, err := c.DoTTL("a", fn(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+		ttl, ok := c.TTL("a")
+		require.True(t, ok)
+		require.Equal(t, time.Minute, ttl)
+
+		// A zero TTL is not cached, nor is NoCache.
+		v, err = c.DoTTL("b", fn(0))
+		require.NoError(t, err)
+		require.Equal(t, 2, v)
+		require.False(t, c.Contains("b"))
+		require.Equal(t, 1, c.Len())
+		v, err = c.DoTTL("b", fn(NoCache))
+		require.NoError(t, err)
+		require.Equal(t, 3, v)
+		require.False(t, c.Contains("b"))
+	})
+
+	t.Run("DoIf", func(t *testing.T) {
+		c := New[string, []int](nil, -1)
+
+		var calls int
+		fn := func() ([]int, bool, error) {
+			calls++
+			if calls == 1 {
+				// Empty results are worth retrying.
+				return nil, false, nil
+			}
+			return []int{calls}, true, nil
+		}
+
+		v, err := c.DoIf("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.Empty(t, v)
+		require.False(t, c.Contains("a"))
+
+		v, err = c.DoIf("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []int{2}, v)
+		v, err = c.DoIf("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, []int{2}, v)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("DoR", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+
+		var calls int
+		fn := func() (int, error) {
+			calls++
+			return calls, nil
+		}
+		v, hit, err := c.DoR("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.False(t, hit)
+		require.Equal(t, 1, v)
+
+		v, hit, err = c.DoR("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.True(t, hit)
+		require.Equal(t, 1, v)
+		require.Equal(t, 1, calls)
+
+		wantErr := errors.New("boom")
+		_, hit, err = c.DoR("b", func() (int, error) {
+			return 0, wantErr
+		}, time.Minute)
+		require.ErrorIs(t, err, wantErr)
+		require.False(t, hit)
+	})
+
+	t.Run("GetOrCompute", func(t *testing.T) {
+		c := New[string](ConstantCost[int], 10)
+
+		release := make(chan struct{})
+		started := make(chan struct{})
+		fn := func() (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		}
+		origins := make(chan Origin, 2)
+		go func() {
+			_, o, _ := c.GetOrCompute("a", fn, time.Minute)
+			origins <- o
+		}()
+		<-started
+		go func() {
+			_, o, _ := c.GetOrCompute("a", func() (int, error) {
+				return 2, nil
+			}, time.Minute)
+			origins <- o
+		}()
+		// Give the second caller a chance to join the flight.
+		require.Eventually(t, func() bool {
+			return c.Stats().Misses == 2
+		}, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		got := []Origin{<-origins, <-origins}
+		require.ElementsMatch(t, []Origin{OriginComputed, OriginShared}, got)
+
+		v, o, err := c.GetOrCompute("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+		require.Equal(t, OriginHit, o)
+		require.Equal(t, "hit", o.String())
+
+		// A flight that finds the value cached by one that completed just
+		// before it doesn't count as computed.
+		_, err, shared, ran := c.doFlight("a", fn, time.Minute)
+		require.NoError(t, err)
+		require.False(t, shared)
+		require.False(t, ran)
+	})
+
+	t.Run("GetWithLoader", func(t *testing.T) {
+		clock := newFakeClock()
+		c := New(nil, -1, WithClock[string, int](clock))
+
+		var calls int
+		loader := func() (int, time.Duration, error) {
+			calls++
+			return calls, time.Duration(calls) * time.Minute, nil
+		}
+
+		v, hit, err := c.GetWithLoader("a", loader)
+		require.NoError(t, err)
+		require.False(t, hit)
+		require.Equal(t, 1, v)
+
+		v, hit, err = c.GetWithLoader("a", loader)
+		require.NoError(t, err)
+		require.True(t, hit)
+		require.Equal(t, 1, v)
+
+		// The TTL comes from the loader.
+		clock.Advance(time.Minute)
+		v, hit, err = c.GetWithLoader("a", loader)
+		require.NoError(t, err)
+		require.False(t, hit)
+		require.Equal(t, 2, v)
+		ttl, ok := c.TTL("a")
+		require.True(t, ok)
+		require.Equal(t, time.Minute*2, ttl)
+
+		// A flight that finds the value cached by one that completed just
+		// before it doesn't run the loader.
+		v, err, shared, ran := c.doTTLFlight("a", loader)
+		require.NoError(t, err)
+		require.False(t, shared)
+		require.False(t, ran)
+		require.Equal(t, 2, v)
+		require.Equal(t, 2, calls)
+
+		wantErr := errors.New("boom")
+		_, hit, err = c.GetWithLoader("b", func() (int, time.Duration, error) {
+			return 0, time.Minute, wantErr
+		})
+		require.ErrorIs(t, err, wantErr)
+		require.False(t, hit)
+		require.False(t, c.Contains("b"))
+	})
+
+	t.Run("DoUnlocked", func(t *testing.T) {
+		c := New[string, int](nil, -1)
+		c.Set("b", 2, time.Minute)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = c.Do("a", func() (int, error) {
+				close(started)
+				<-release
+				return 1, nil
+			}, time.Minute)
+		}()
+		<-started
+
+		// A slow fn for "a" must not block other operations.
+		v, _, ok := c.Get("b")
+		require.True(t, ok)
+		require.Equal(t, 2, v)
+		c.Set("c", 3, time.Minute)
+		require.Equal(t, 2, c.Len())
+
+		close(release)
+		<-done
+		require.True(t, c.Contains("a"))
+	})
+
+	t.Run("DoDedupe", func(t *testing.T) {
+		c := New[string, int](nil, -1)
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		fn := func() (int, error) {
+			calls.Add(1)
+			<-release
+			return 42, nil
+		}
+
+		type result struct {
+			v   int
+			err error
+		}
+		results := make(chan result, 10)
+		for i := 0; i < 10; i++ {
+			go func() {
+				v, err := c.Do("a", fn, time.Second)
+				results <- result{v, err}
+			}()
+		}
+		// Give the goroutines a chance to pile up behind the first call.
+		time.Sleep(time.Millisecond * 50)
+		close(release)
+		for i := 0; i < 10; i++ {
+			res := <-results
+			require.NoError(t, res.err)
+			require.Equal(t, 42, res.v)
+		}
+
+		require.EqualValues(t, 1, calls.Load())
+	})
+}
+
+func TestTLRU_Expires(t *testing.T) {
+	t.Parallel()
+	t.Run("ImmediateExpirey", func(t *testing.T) {
+		t.Parallel()
+		c := New[string](ConstantCost[int], 10)
+		// This entry should immediately expire.
+		c.Set("a", 10, 0)
+		_, _, ok := c.Get("a")
+		require.False(t, ok)
+	})
+	t.Run("NeverExpires", func(t *testing.T) {
+		t.Parallel()
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 10, time.Hour*999)
+		clock.Advance(time.Second)
+		_, _, ok := c.Get("a")
+		require.True(t, ok)
+	})
+	t.Run("IdenticalDeadlines", func(t *testing.T) {
+		t.Parallel()
+		clock := newFakeClock()
+		c := New(ConstantCost[int], -1, WithClock[string, int](clock))
+		deadline := clock.Now().Add(time.Minute)
+		for i := 0; i < 100; i++ {
+			c.SetWithDeadline(strconv.Itoa(i), i, deadline)
+		}
+		// Colliding deadlines are kept exact rather than bumped apart.
+		for i := 0; i < 100; i++ {
+			_, got, ok := c.Peek(strconv.Itoa(i))
+			require.True(t, ok)
+			require.True(t, deadline.Equal(got), "deadline of %v is %v", i, got)
+		}
+
+		clock.Advance(time.Minute)
+		require.Equal(t, 100, c.Evict())
+		require.Equal(t, 0, c.ttlHeap.Len())
+	})
+	t.Run("IdenticalDeadlinesNoSkew", func(t *testing.T) {
+		t.Parallel()
+		clock := newFakeClock()
+		c := New(ConstantCost[int], -1, WithClock[string, int](clock))
+		deadline := clock.Now().Add(time.Minute)
+		const n = 100000
+		for i := 0; i < n; i++ {
+			c.SetWithDeadline(strconv.Itoa(i), i, deadline)
+		}
+		items := c.Items()
+		require.Len(t, items, n)
+		for _, it := range items {
+			require.True(t, deadline.Equal(it.Deadline), "deadline of %v is %v", it.Key, it.Deadline)
+		}
+	})
+	t.Run("DeleteIdenticalDeadlines", func(t *testing.T) {
+		t.Parallel()
+		clock := newFakeClock()
+		c := New(ConstantCost[int], -1,
+			WithClock[string, int](clock),
+			WithRefreshOnGet[string, int](time.Minute),
+		)
+		for i := 0; i < 1000; i++ {
+			c.Set(strconv.Itoa(i), i, time.Minute)
+		}
+		// Move some deadlines around, colliding with each other again.
+		for i := 0; i+2 < 1000; i += 3 {
+			c.Get(strconv.Itoa(i))
+			c.Touch(strconv.Itoa(i+1), time.Minute)
+			c.Set(strconv.Itoa(i+2), i, time.Minute)
+		}
+
+		require.NotPanics(t, func() {
+			for i := 0; i < 1000; i++ {
+				require.Equal(t, 1, c.Delete(strconv.Itoa(i)))
+			}
+		})
+		require.Equal(t, 0, c.ttlHeap.Len())
+		require.Equal(t, 0, c.Len())
+		require.Equal(t, 0, c.Cost())
+	})
+	t.Run("FakeClock", func(t *testing.T) {
+		t.Parallel()
+		clock := newFakeClock()
+		c := New(ConstantCost[int], 10, WithClock[string, int](clock))
+		c.Set("a", 10, time.Minute)
+		c.Set("b", 20, time.Hour)
+
+		clock.Advance(time.Minute - time.Nanosecond)
+		require.True(t, c.Contains("a"))
+		ttl, ok := c.TTL("a")
+		require.True(t, ok)
+		require.Equal(t, time.Nanosecond, ttl)
+
+		clock.Advance(time.Nanosecond * 2)
+		_, _, ok = c.Get("a")
+		require.False(t, ok)
+		require.Equal(t, 1, c.Len())
+	})
+}
+
+func Benchmark_TLRU_Get(b *testing.B) {
+	c := New[string](ConstantCost[int], 1000)
+	c.Set("test-key", 10, time.Second)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get("test-key")
+	}
+}
+
+func Benchmark_TLRU_GetParallel(b *testing.B) {
+	c := New[string](ConstantCost[int], 1000)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "test-key-" + strconv.Itoa(i)
+		c.Set(keys[i], i, time.Hour)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// Each goroutine works a small hot set, as in a read-heavy
+		// workload.
+		var i int
+		for pb.Next() {
+			c.Get(keys[i%16])
+			i++
+		}
+	})
+}
+
+func Benchmark_TLRU_Set(b *testing.B) {
+	c := New[string](ConstantCost[int], 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Set("test-key-"+strconv.Itoa(i), 10, time.Second)
+	}
+}
+
+func Benchmark_TLRU_SetEvictMany(b *testing.B) {
+	const n = 10000
+	c := New[string](func(v int) int {
+		return v
+	}, n)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "test-key-" + strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j, key := range keys {
+			c.Set(key, 1, time.Hour+time.Duration(j%100)*time.Second)
+		}
+		b.StartTimer()
+		// Evicts half of the cache.
+		c.Set("large", n/2, time.Hour)
+	}
+}
+
+func Benchmark_TLRU_GetChurn(b *testing.B) {
+	const n = 1000
+	c := New[string](ConstantCost[int], n)
+	keys := make([]string, 2*n)
+	for i := range keys {
+		keys[i] = "test-key-" + strconv.Itoa(i)
+	}
+	for _, key := range keys[:n] {
+		c.Set(key, 1, time.Hour)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Each Set at the cost limit evicts an entry, so lookups compete
+		// with eviction for the lock and the LRU list.
+		c.Set(keys[(i+n)%len(keys)], 1, time.Hour)
+		c.Get(keys[i%len(keys)])
+	}
+}
+
+func Benchmark_TLRU_DoParallel(b *testing.B) {
+	c := New[string](ConstantCost[int], 1000)
+	keys := make([]string, 16)
+	for i := range keys {
+		keys[i] = "test-key-" + strconv.Itoa(i)
+	}
+	fn := func() (int, error) {
+		return 1, nil
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// A TTL this short makes most calls miss, so goroutines contend on
+		// the same flights.
+		var i int
+		for pb.Next() {
+			c.Do(keys[i%len(keys)], fn, time.Microsecond)
+			i++
+		}
+	})
+}
+
+// checkInvariants verifies that the cache's indices agree with each other.
+func checkInvariants[K comparable, V any](t *testing.T, c *Cache[K, V]) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries, expiring, graced, cost int
+	for node := c.lruList.Tail(); node != nil; node = node.Next() {
+		entries++
+		require.Same(t, node, c.index[node.Data.key], "list and index disagree")
+		require.Equal(t, c.costOf(node.Data.key, node.Data.data), node.Data.cost)
+		cost += node.Data.cost
+		if node.Data.expiry != nil {
+			expiring++
+			require.Equal(t, node.Data.key, node.Data.expiry.Value.key)
+		}
+		if node.Data.grace > 0 {
+			graced++
+		}
+	}
+	require.Equal(t, len(c.index), entries)
+	require.Equal(t, c.ttlHeap.Len(), expiring)
+	require.Equal(t, c.graced, graced)
+	require.Equal(t, c.cost, cost)
+	if c.policy == LFU {
+		require.Equal(t, entries, c.lfuHeap.Len())
+	}
+	c.ttlHeap.Walk(func(it *minheap.Item[expiry[K]]) bool {
+		node, ok := c.index[it.Value.key]
+		require.True(t, ok, "ttlHeap holds a deleted key")
+		require.Same(t, it, node.Data.expiry)
+		return true
+	})
+}
+
+func TestStress(t *testing.T) {
+	for name, policy := range map[string]Policy{"LRU": LRU, "LFU": LFU} {
+		policy := policy
+		t.Run(name, func(t *testing.T) {
+			stress(t, New(func(v int) int {
+				return v%4 + 1
+			}, 64, WithPolicy[int, int](policy)))
+		})
+	}
+}
+
+// stress hammers c with random operations on overlapping keys from many
+// goroutines, then checks that it is still consistent.
+func stress(t *testing.T, c *Cache[int, int]) {
+	deadline := time.Now().Add(200 * time.Millisecond)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) {
+				key := rng.Intn(128)
+				ttl := time.Duration(rng.Intn(5)) * time.Millisecond
+				switch rng.Intn(8) {
+				case 0, 1:
+					c.Get(key)
+				case 2:
+					c.Set(key, rng.Int(), ttl)
+				case 3:
+					c.Delete(key)
+				case 4:
+					c.Do(key, func() (int, error) {
+						return key, nil
+					}, ttl)
+				case 5:
+					c.DoStale(key, func() (int, error) {
+						return key, nil
+					}, ttl, time.Millisecond)
+				case 6:
+					c.Pop(key)
+				case 7:
+					c.Peek(key)
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	checkInvariants(t, c)
+	require.LessOrEqual(t, c.Cost(), 64)
 }
@@ -0,0 +1,38 @@
+package tlru
+
+import "time"
+
+// Tx gives access to a cache while its lock is held by Transaction. It
+// must not be used after the transaction returns.
+type Tx[K comparable, V any] struct {
+	c *Cache[K, V]
+}
+
+// Transaction calls fn with the cache locked, so that the operations fn
+// performs through tx are atomic with respect to other goroutines. fn must
+// not call the cache's own methods, which would deadlock.
+func (l *Cache[K, V]) Transaction(fn func(tx *Tx[K, V])) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fn(&Tx[K, V]{c: l})
+}
+
+// Get is like Cache.Get.
+func (tx *Tx[K, V]) Get(key K) (v V, deadline time.Time, exists bool) {
+	return tx.c.get(key)
+}
+
+// Set is like Cache.Set.
+func (tx *Tx[K, V]) Set(key K, v V, ttl time.Duration) {
+	tx.c.set(key, v, tx.c.deadline(ttl))
+}
+
+// Delete is like Cache.Delete.
+func (tx *Tx[K, V]) Delete(key K) int {
+	tx.c.forgetError(key)
+	if _, ok := tx.c.index[key]; !ok {
+		return 0
+	}
+	return tx.c.delete(key, ReasonManual)
+}
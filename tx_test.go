@@ -0,0 +1,40 @@
+package tlru
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransaction(t *testing.T) {
+	c := New[string](ConstantCost[int], -1)
+	c.Set("a", 1, time.Minute)
+	c.Set("c", 3, time.Minute)
+
+	c.Transaction(func(tx *Tx[string, int]) {
+		v, _, ok := tx.Get("a")
+		require.True(t, ok)
+		tx.Set("b", v+1, time.Minute)
+		require.Equal(t, 1, tx.Delete("c"))
+		require.Equal(t, 0, tx.Delete("c"))
+	})
+	require.Equal(t, []string{"a", "b"}, c.Keys())
+
+	// Read-modify-write cycles don't interleave.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Transaction(func(tx *Tx[string, int]) {
+				v, _, _ := tx.Get("n")
+				tx.Set("n", v+1, time.Minute)
+			})
+		}()
+	}
+	wg.Wait()
+	v, _, _ := c.Get("n")
+	require.Equal(t, 100, v)
+}
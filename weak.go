@@ -0,0 +1,110 @@
+//go:build go1.24
+
+package tlru
+
+import (
+	"runtime"
+	"time"
+	"weak"
+)
+
+// weakEntry is a weakly held value along with the cost it had when it
+// was set, so that accounting doesn't change once the value is collected.
+type weakEntry[T any] struct {
+	ptr  weak.Pointer[T]
+	cost int
+}
+
+// WeakCache is a Cache that holds its values weakly, letting the garbage
+// collector reclaim any value that is not referenced elsewhere. Collected
+// values are treated as misses and removed from the cache.
+//
+// WeakCache suits large values that are cheap to reconstruct, bounding
+// memory more aggressively than a cost limit alone.
+type WeakCache[K comparable, T any] struct {
+	c    *Cache[K, weakEntry[T]]
+	cost Coster[*T]
+}
+
+// NewWeak instantiates a WeakCache. cost and costLimit behave as in New.
+func NewWeak[K comparable, T any](cost Coster[*T], costLimit int) *WeakCache[K, T] {
+	if cost == nil {
+		cost = ConstantCost[*T]
+	}
+	return &WeakCache[K, T]{
+		c: New[K](func(e weakEntry[T]) int {
+			return e.cost
+		}, costLimit),
+		cost: cost,
+	}
+}
+
+// Set adds a new value to the cache. The cache does not keep v alive.
+func (w *WeakCache[K, T]) Set(key K, v *T, ttl time.Duration) {
+	e := weakEntry[T]{ptr: weak.Make(v), cost: w.cost(v)}
+	if v != nil {
+		// Drop the entry as soon as v is collected rather than waiting
+		// for a lookup to notice.
+		runtime.AddCleanup(v, func(key K) {
+			w.remove(key, e)
+		}, key)
+	}
+	w.c.Set(key, e, ttl)
+}
+
+// Get retrieves a value from the cache, if it exists and has not been
+// collected.
+func (w *WeakCache[K, T]) Get(key K) (v *T, deadline time.Time, exists bool) {
+	e, deadline, ok := w.c.Get(key)
+	if !ok {
+		return nil, deadline, false
+	}
+	v = e.ptr.Value()
+	if v == nil {
+		w.remove(key, e)
+		return nil, time.Time{}, false
+	}
+	return v, deadline, true
+}
+
+// Delete removes an entry from the cache, returning cost savings.
+func (w *WeakCache[K, T]) Delete(key K) int {
+	return w.c.Delete(key)
+}
+
+// Do retrieves a value from the cache, calling fn to compute and set it if
+// it is missing or was collected. Unlike Cache.Do, concurrent calls for the
+// same key are not deduplicated.
+func (w *WeakCache[K, T]) Do(key K, fn func() (*T, error), ttl time.Duration) (*T, error) {
+	if v, _, ok := w.Get(key); ok {
+		return v, nil
+	}
+	v, err := fn()
+	if err != nil {
+		return v, err
+	}
+	w.Set(key, v, ttl)
+	return v, nil
+}
+
+// Len returns the number of entries in the cache. Entries whose values
+// were collected may be counted until their removal.
+func (w *WeakCache[K, T]) Len() int {
+	return w.c.Len()
+}
+
+// Evict forcibly evicts expired entries and entries over the cost limit,
+// returning the total cost evicted.
+func (w *WeakCache[K, T]) Evict() int {
+	return w.c.Evict()
+}
+
+// remove deletes the entry for key if it still holds e.
+func (w *WeakCache[K, T]) remove(key K, e weakEntry[T]) {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	if node, ok := w.c.index[key]; ok && node.Data.data == e {
+		w.c.delete(key, ReasonManual)
+	}
+}
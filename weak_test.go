@@ -0,0 +1,39 @@
+//go:build go1.24
+
+package tlru
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeakCache(t *testing.T) {
+	c := NewWeak[string, [1 << 10]byte](nil, 10)
+
+	v := new([1 << 10]byte)
+	c.Set("a", v, time.Hour)
+	got, _, ok := c.Get("a")
+	require.True(t, ok)
+	require.Same(t, v, got)
+	runtime.KeepAlive(v)
+
+	// Once unreferenced, the value is collected and the entry dropped.
+	v, got = nil, nil
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		_, _, ok := c.Get("a")
+		return !ok && c.Len() == 0
+	}, time.Second, time.Millisecond)
+
+	v, err := c.Do("a", func() (*[1 << 10]byte, error) {
+		return new([1 << 10]byte), nil
+	}, time.Hour)
+	require.NoError(t, err)
+	got, _, ok = c.Get("a")
+	require.True(t, ok)
+	require.Same(t, v, got)
+	runtime.KeepAlive(v)
+}